@@ -6,15 +6,14 @@ import (
 
 	log "github.com/sirupsen/logrus"
 
-	"github.com/Tweddle-SE-Team/goaws/services/common"
-	"github.com/Tweddle-SE-Team/goaws/services/sns"
-	"github.com/Tweddle-SE-Team/goaws/services/sqs"
 	"github.com/ghodss/yaml"
 )
 
 type EnvSubsciption struct {
-	QueueName string
-	Raw       bool
+	QueueName         string
+	Raw               bool
+	FilterPolicy      string
+	FilterPolicyScope string
 }
 
 type EnvTopic struct {
@@ -26,6 +25,11 @@ type EnvQueue struct {
 	Name string
 }
 
+type EnvCredential struct {
+	AccessKeyId     string
+	SecretAccessKey string
+}
+
 type Environment struct {
 	Host        string
 	Port        string
@@ -36,76 +40,54 @@ type Environment struct {
 	LogFile     string
 	Topics      []EnvTopic
 	Queues      []EnvQueue
+	Credentials []EnvCredential
+	Storage     string
+	StoragePath string
 }
 
-var envs map[string]Environment
-
-func LoadYamlConfig(filename string, env string) []string {
-	ports := []string{"4100"}
-
+// Load reads an environment of the config file, /etc/goaws/config.yaml and the Local environment by default
+func Load(filename string, env string) (*Environment, error) {
 	if filename == "" {
 		filename, _ = filepath.Abs("/etc/goaws/config.yaml")
 	}
+	if env == "" {
+		env = "Local"
+	}
 	log.Warnf("Loading config file: %s", filename)
 	yamlFile, err := ioutil.ReadFile(filename)
 	if err != nil {
-		return ports
-	}
-
-	err = yaml.Unmarshal(yamlFile, &envs)
-	if err != nil {
-		log.Printf("err: %v\n", err)
-		return ports
+		return nil, err
 	}
-	if env == "" {
-		env = "Local"
+	var envs map[string]Environment
+	if err := yaml.Unmarshal(yamlFile, &envs); err != nil {
+		return nil, err
 	}
+	environment := envs[env]
+	return &environment, nil
+}
 
-	if envs[env].Port != "" {
-		ports = []string{envs[env].Port}
-	} else if envs[env].SqsPort != "" && envs[env].SnsPort != "" {
-		ports = []string{envs[env].SqsPort, envs[env].SnsPort}
+// Ports lists the ports to listen on: Port, or SqsPort and SnsPort, 4100 by default
+func (e *Environment) Ports() []string {
+	if e.Port != "" {
+		return []string{e.Port}
+	} else if e.SqsPort != "" && e.SnsPort != "" {
+		return []string{e.SqsPort, e.SnsPort}
 	}
+	return []string{"4100"}
+}
 
-	common.LogMessages = false
-	common.LogFile = "./goaws_messages.log"
-
-	if envs[env].LogMessages == true {
-		common.LogMessages = true
-		if envs[env].LogFile != "" {
-			common.LogFile = envs[env].LogFile
-		}
-	}
-	queueHost := envs[env].Host + ":" + ports[0]
-	for _, queueEnv := range envs[env].Queues {
-		queue := sqs.NewQueue(queueEnv.Name, queueHost)
-		sqs.Service.Queues.Put(queue)
+// MessageLogFile is where messages are logged when LogMessages is set
+func (e *Environment) MessageLogFile() string {
+	if e.LogFile != "" {
+		return e.LogFile
 	}
-	for _, topic := range envs[env].Topics {
-		newTopic := sns.NewTopic(nil, &topic.Name)
-		queueEquals := func(s interface{}, v interface{}) bool {
-			src := s.(*sqs.Queue)
-			value := v.(*string)
-			return src.Name == *value
-		}
-		for _, subs := range topic.Subscriptions {
-			q := sqs.Service.Queues.Get(&subs.QueueName, queueEquals)
-			if q == nil {
-				queue := sqs.NewQueue(subs.QueueName, queueHost)
-				sqs.Service.Queues.Put(queue)
-				subscription := sns.NewSubscription(newTopic.Arn, "sqs", queue.URL, subs.Raw)
-				newTopic.Subscriptions.Put(subscription)
-			} else {
-				queue := q.(sqs.Queue)
-				subscription := sns.NewSubscription(newTopic.Arn, "sqs", queue.URL, subs.Raw)
-				newTopic.Subscriptions.Put(subscription)
-			}
-		}
-		sns.Service.Topics.Put(newTopic)
-	}
-	return ports
+	return "./goaws_messages.log"
 }
 
-func GetLogFileName(env string) (string, bool) {
-	return envs[env].LogFile, envs[env].LogMessages
+// StorageFile is the file state is kept in when Storage is file
+func (e *Environment) StorageFile() string {
+	if e.StoragePath != "" {
+		return e.StoragePath
+	}
+	return "./goaws_storage.log"
 }
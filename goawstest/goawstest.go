@@ -0,0 +1,169 @@
+// Package goawstest runs an in-process GoAws for Go tests: every Server has its own queues and topics,
+// listens on a random local port and is shut down when the test finishes.
+package goawstest
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+
+	"github.com/Tweddle-SE-Team/goaws/services/emulator"
+	"github.com/Tweddle-SE-Team/goaws/services/router"
+)
+
+// Region the clients are configured for, GoAws accepts any region
+const Region = "us-east-1"
+
+// Server is an in-process GoAws with preconfigured aws-sdk-go clients
+type Server struct {
+	// Emulator holds the queues and topics of this server
+	Emulator *emulator.Emulator
+	// URL is the endpoint of the server (e.g.: http://127.0.0.1:54321)
+	URL string
+	SQS *sqs.SQS
+	SNS *sns.SNS
+	t   testing.TB
+}
+
+type options struct {
+	accessKeyId     string
+	secretAccessKey string
+	signed          bool
+}
+
+type Option func(*options)
+
+// WithCredentials makes the server require requests signed with this key, the clients sign with it
+func WithCredentials(accessKeyId string, secretAccessKey string) Option {
+	return func(o *options) {
+		o.accessKeyId = accessKeyId
+		o.secretAccessKey = secretAccessKey
+		o.signed = true
+	}
+}
+
+// New starts a server which is shut down with t.Cleanup
+func New(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+	o := options{accessKeyId: "goawstest", secretAccessKey: "goawstest"}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	e := emulator.New()
+	if o.signed {
+		e.Auth.SetCredentials(map[string]string{o.accessKeyId: o.secretAccessKey})
+	}
+	e.Start()
+	server := httptest.NewServer(router.New(e))
+	t.Cleanup(func() {
+		server.Close()
+		e.Close()
+	})
+
+	sess, err := session.NewSession(aws.NewConfig().
+		WithRegion(Region).
+		WithEndpoint(server.URL).
+		WithCredentials(credentials.NewStaticCredentials(o.accessKeyId, o.secretAccessKey, "")))
+	if err != nil {
+		t.Fatalf("goawstest: failed to create an AWS session: %v", err)
+	}
+	return &Server{
+		Emulator: e,
+		URL:      server.URL,
+		SQS:      sqs.New(sess),
+		SNS:      sns.New(sess),
+		t:        t}
+}
+
+// CreateQueue creates a queue with the given attributes and returns its URL
+func (s *Server) CreateQueue(name string, attributes map[string]string) string {
+	s.t.Helper()
+	output, err := s.SQS.CreateQueue(&sqs.CreateQueueInput{
+		QueueName:  aws.String(name),
+		Attributes: aws.StringMap(attributes)})
+	if err != nil {
+		s.t.Fatalf("goawstest: failed to create queue %s: %v", name, err)
+	}
+	return aws.StringValue(output.QueueUrl)
+}
+
+// CreateTopic creates a topic and returns its ARN
+func (s *Server) CreateTopic(name string) string {
+	s.t.Helper()
+	output, err := s.SNS.CreateTopic(&sns.CreateTopicInput{Name: aws.String(name)})
+	if err != nil {
+		s.t.Fatalf("goawstest: failed to create topic %s: %v", name, err)
+	}
+	return aws.StringValue(output.TopicArn)
+}
+
+// SubscribeQueue subscribes a queue to a topic and returns the subscription ARN
+func (s *Server) SubscribeQueue(topicArn string, queueURL string) string {
+	s.t.Helper()
+	output, err := s.SNS.Subscribe(&sns.SubscribeInput{
+		TopicArn: aws.String(topicArn),
+		Protocol: aws.String("sqs"),
+		Endpoint: aws.String(queueURL)})
+	if err != nil {
+		s.t.Fatalf("goawstest: failed to subscribe %s to %s: %v", queueURL, topicArn, err)
+	}
+	return aws.StringValue(output.SubscriptionArn)
+}
+
+// SendMessage sends a message to a queue and returns its message id
+func (s *Server) SendMessage(queueURL string, body string) string {
+	s.t.Helper()
+	output, err := s.SQS.SendMessage(&sqs.SendMessageInput{QueueUrl: aws.String(queueURL), MessageBody: aws.String(body)})
+	if err != nil {
+		s.t.Fatalf("goawstest: failed to send a message to %s: %v", queueURL, err)
+	}
+	return aws.StringValue(output.MessageId)
+}
+
+// Messages returns the bodies of the visible messages of a queue, by name or URL, without receiving them
+func (s *Server) Messages(queue string) []string {
+	s.t.Helper()
+	segments := strings.Split(queue, "/")
+	q := s.Emulator.SQS.GetQueue(segments[len(segments)-1])
+	if q == nil {
+		s.t.Fatalf("goawstest: queue %s does not exist", queue)
+	}
+	bodies := []string{}
+	for _, message := range q.Peek() {
+		bodies = append(bodies, string(message.MessageBody))
+	}
+	return bodies
+}
+
+// AssertMessages checks the bodies of the visible messages of a queue, in order
+func (s *Server) AssertMessages(queue string, bodies ...string) {
+	s.t.Helper()
+	if bodies == nil {
+		bodies = []string{}
+	}
+	if actual := s.Messages(queue); !reflect.DeepEqual(actual, bodies) {
+		s.t.Errorf("goawstest: queue %s holds messages %q, expected %q", queue, actual, bodies)
+	}
+}
+
+// AssertQueueSize checks the number of visible messages of a queue
+func (s *Server) AssertQueueSize(queue string, size int) {
+	s.t.Helper()
+	if actual := len(s.Messages(queue)); actual != size {
+		s.t.Errorf("goawstest: queue %s holds %d messages, expected %d", queue, actual, size)
+	}
+}
+
+// AssertQueueEmpty checks that a queue has no visible messages
+func (s *Server) AssertQueueEmpty(queue string) {
+	s.t.Helper()
+	s.AssertQueueSize(queue, 0)
+}
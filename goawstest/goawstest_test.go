@@ -0,0 +1,69 @@
+package goawstest
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+func TestServer_Queue(t *testing.T) {
+	t.Parallel()
+	server := New(t)
+	queueURL := server.CreateQueue("harness-queue", map[string]string{"VisibilityTimeout": "60"})
+	server.AssertQueueEmpty("harness-queue")
+
+	server.SendMessage(queueURL, "first")
+	server.SendMessage(queueURL, "second")
+	server.AssertMessages(queueURL, "first", "second")
+
+	output, err := server.SQS.ReceiveMessage(&sqs.ReceiveMessageInput{QueueUrl: aws.String(queueURL)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(output.Messages) != 1 || aws.StringValue(output.Messages[0].Body) != "first" {
+		t.Fatalf("expected to receive the first message, got %v", output.Messages)
+	}
+	server.AssertMessages("harness-queue", "second")
+}
+
+func TestServer_Topic(t *testing.T) {
+	t.Parallel()
+	server := New(t)
+	queueURL := server.CreateQueue("subscriber-queue", nil)
+	topicArn := server.CreateTopic("harness-topic")
+	server.SubscribeQueue(topicArn, queueURL)
+
+	if _, err := server.SNS.Publish(&sns.PublishInput{TopicArn: aws.String(topicArn), Message: aws.String("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	server.AssertQueueSize("subscriber-queue", 1)
+}
+
+func TestServer_Isolated(t *testing.T) {
+	t.Parallel()
+	first := New(t)
+	second := New(t)
+	first.CreateQueue("isolated-queue", nil)
+
+	output, err := second.SQS.ListQueues(&sqs.ListQueuesInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(output.QueueUrls) != 0 {
+		t.Errorf("expected the second server to have no queues, got %v", aws.StringValueSlice(output.QueueUrls))
+	}
+}
+
+func TestServer_WithCredentials(t *testing.T) {
+	t.Parallel()
+	server := New(t, WithCredentials("AKIDHARNESS", "secret"))
+	server.CreateQueue("signed-queue", nil)
+
+	server.SQS.Config.Credentials = credentials.NewStaticCredentials("AKIDHARNESS", "wrong", "")
+	if _, err := server.SQS.ListQueues(&sqs.ListQueuesInput{}); err == nil {
+		t.Errorf("expected a request signed with the wrong secret to be rejected")
+	}
+}
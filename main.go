@@ -6,19 +6,26 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/Tweddle-SE-Team/goaws/config"
+	"github.com/Tweddle-SE-Team/goaws/services/emulator"
 	"github.com/Tweddle-SE-Team/goaws/services/router"
+	"github.com/Tweddle-SE-Team/goaws/services/snapshot"
 )
 
 func main() {
 	var filename string
 	var debug bool
+	var loadSnapshot, saveSnapshot string
 	flag.StringVar(&filename, "config", "", "config file location + name")
 	flag.BoolVar(&debug, "debug", false, "debug log level (default Warning)")
+	flag.StringVar(&loadSnapshot, "load-snapshot", "", "snapshot file to restore queues, messages and topics from at startup")
+	flag.StringVar(&saveSnapshot, "save-snapshot", "", "snapshot file to write queues, messages and topics to on SIGINT / SIGTERM")
 	flag.Parse()
 
 	log.SetFormatter(&log.JSONFormatter{})
@@ -34,9 +41,30 @@ func main() {
 		env = flag.Arg(0)
 	}
 
-	portNumbers := config.LoadYamlConfig(filename, env)
+	environment, err := config.Load(filename, env)
+	if err != nil {
+		log.Warnf("Could not load config file, starting without queues or topics: %v", err)
+		environment = &config.Environment{}
+	}
+	e, err := emulator.NewFromConfig(environment)
+	if err != nil {
+		log.Fatalf("Failed to set up GoAws: %v", err)
+	}
+	portNumbers := environment.Ports()
+	if loadSnapshot != "" {
+		s, err := snapshot.ReadFile(loadSnapshot)
+		if err != nil {
+			log.Fatalf("Failed to load snapshot %s: %v", loadSnapshot, err)
+		}
+		e.Restore(s)
+		log.Warnf("Restored %d queues and %d topics from %s", len(s.Queues), len(s.Topics), loadSnapshot)
+	}
+	if saveSnapshot != "" {
+		go saveSnapshotOnExit(e, saveSnapshot)
+	}
+	e.Start()
 
-	r := router.New()
+	r := router.New(e)
 
 	if len(portNumbers) == 1 {
 		log.Warnf("SNS and SQS listening on: 0.0.0.0:%s", portNumbers[0])
@@ -56,7 +84,22 @@ func main() {
 	}
 }
 
+// saveSnapshotOnExit writes the state to a snapshot file once the process is asked to stop
+func saveSnapshotOnExit(e *emulator.Emulator, path string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	if err := e.Snapshot().WriteFile(path); err != nil {
+		log.Errorf("Failed to save snapshot %s: %v", path, err)
+		os.Exit(1)
+	}
+	log.Warnf("Saved snapshot to %s", path)
+	os.Exit(0)
+}
+
 type Server struct {
+	// Emulator holds the queues and topics of this server, isolated from every other server
+	Emulator *emulator.Emulator
 	closed   bool
 	handler  http.Handler
 	listener net.Listener
@@ -69,6 +112,7 @@ func (srv *Server) Quit() error {
 	srv.closed = true
 	srv.mu.Unlock()
 
+	srv.Emulator.Close()
 	return srv.listener.Close()
 }
 
@@ -88,7 +132,9 @@ func New(addr string) (*Server, error) {
 		return nil, fmt.Errorf("cannot listen on localhost: %v", err)
 	}
 
-	srv := Server{listener: l, handler: router.New()}
+	e := emulator.New()
+	e.Start()
+	srv := Server{Emulator: e, listener: l, handler: router.New(e)}
 
 	go http.Serve(l, &srv)
 
@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"github.com/Tweddle-SE-Team/goaws/services/common"
+	"net/http"
+)
+
+var (
+	ErrMissingAuthenticationToken = &common.ErrorType{
+		HttpError: http.StatusForbidden,
+		Type:      "Sender",
+		Code:      "MissingAuthenticationToken",
+		Message:   "Request is missing Authentication Token"}
+	ErrIncompleteSignature = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "IncompleteSignature",
+		Message:   "The request signature does not conform to AWS standards."}
+	ErrInvalidClientTokenId = &common.ErrorType{
+		HttpError: http.StatusForbidden,
+		Type:      "Sender",
+		Code:      "InvalidClientTokenId",
+		Message:   "The security token included in the request is invalid."}
+	ErrSignatureDoesNotMatch = &common.ErrorType{
+		HttpError: http.StatusForbidden,
+		Type:      "Sender",
+		Code:      "SignatureDoesNotMatch",
+		Message:   "The request signature we calculated does not match the signature you provided. Check your AWS Secret Access Key and signing method. Consult the service documentation for details."}
+	ErrRequestExpired = &common.ErrorType{
+		HttpError: http.StatusForbidden,
+		Type:      "Sender",
+		Code:      "RequestExpired",
+		Message:   "Request has expired."}
+	ErrXAmzContentSHA256Mismatch = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "XAmzContentSHA256Mismatch",
+		Message:   "The provided 'x-amz-content-sha256' header does not match what was computed."}
+)
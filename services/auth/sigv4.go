@@ -0,0 +1,310 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	algorithm       = "AWS4-HMAC-SHA256"
+	timeFormat      = "20060102T150405Z"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	// MaxClockSkew is how far the signing time of a header signed request may be from the server time,
+	// and how far ahead of it a presigned request may be signed
+	MaxClockSkew = 15 * time.Minute
+)
+
+// Verifier checks AWS Signature Version 4 signatures, it accepts every request while it has no credentials
+type Verifier struct {
+	credentials map[string]string
+	now         func() time.Time
+	lock        sync.RWMutex
+}
+
+func NewVerifier() *Verifier {
+	return &Verifier{credentials: make(map[string]string), now: time.Now}
+}
+
+// SetCredentials replaces the access key id / secret access key pairs requests can be signed with
+func (v *Verifier) SetCredentials(credentials map[string]string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.credentials = make(map[string]string)
+	for accessKeyId, secretAccessKey := range credentials {
+		v.credentials[accessKeyId] = secretAccessKey
+	}
+}
+
+// Enabled reports whether requests must be signed
+func (v *Verifier) Enabled() bool {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	return len(v.credentials) > 0
+}
+
+func (v *Verifier) secret(accessKeyId string) (string, bool) {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	secret, ok := v.credentials[accessKeyId]
+	return secret, ok
+}
+
+type signature struct {
+	accessKeyId   string
+	scope         string
+	date          string
+	amzDate       string
+	signedHeaders []string
+	signature     string
+	expires       time.Duration
+	presigned     bool
+}
+
+// Verify checks the signature in the Authorization header or the X-Amz-* query parameters of a presigned request
+func (v *Verifier) Verify(request *http.Request) error {
+	if !v.Enabled() {
+		return nil
+	}
+	var sig *signature
+	var err error
+	if request.URL.Query().Get("X-Amz-Algorithm") != "" {
+		sig, err = parseQuerySignature(request.URL.Query())
+	} else if authorization := request.Header.Get("Authorization"); authorization != "" {
+		sig, err = parseAuthorizationHeader(authorization, request)
+	} else {
+		return ErrMissingAuthenticationToken
+	}
+	if err != nil {
+		return err
+	}
+	secret, ok := v.secret(sig.accessKeyId)
+	if !ok {
+		return ErrInvalidClientTokenId
+	}
+
+	signedAt, err := time.Parse(timeFormat, sig.amzDate)
+	if err != nil || !strings.HasPrefix(sig.amzDate, sig.date) {
+		return ErrIncompleteSignature.WithMessage("Date must be in ISO-8601 'basic format' and match the credential scope")
+	}
+	now := v.now()
+	if signedAt.Sub(now) > MaxClockSkew {
+		return ErrSignatureDoesNotMatch.WithMessage(fmt.Sprintf("Signature not yet current: %s is still later than %s", sig.amzDate, now.UTC().Add(MaxClockSkew).Format(timeFormat)))
+	}
+	if sig.presigned {
+		if now.After(signedAt.Add(sig.expires)) {
+			return ErrRequestExpired
+		}
+	} else if now.Sub(signedAt) > MaxClockSkew {
+		return ErrSignatureDoesNotMatch.WithMessage(fmt.Sprintf("Signature expired: %s is now earlier than %s", sig.amzDate, now.UTC().Add(-MaxClockSkew).Format(timeFormat)))
+	}
+
+	body, err := readBody(request)
+	if err != nil {
+		return err
+	}
+	payloadHashes := []string{hashHex(body)}
+	if contentHash := request.Header.Get("X-Amz-Content-Sha256"); contentHash != "" {
+		// the header is signed in place of the body, so it must hash the body actually sent
+		if contentHash != unsignedPayload && contentHash != payloadHashes[0] {
+			return ErrXAmzContentSHA256Mismatch
+		}
+		payloadHashes = []string{contentHash}
+	} else if sig.presigned {
+		payloadHashes = append(payloadHashes, unsignedPayload)
+	}
+	signingKey := deriveSigningKey(secret, sig.scope)
+	for _, payloadHash := range payloadHashes {
+		canonicalRequest := buildCanonicalRequest(request, sig.signedHeaders, payloadHash)
+		stringToSign := strings.Join([]string{algorithm, sig.amzDate, sig.scope, hashHex([]byte(canonicalRequest))}, "\n")
+		expected := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+		if hmac.Equal([]byte(expected), []byte(sig.signature)) {
+			return nil
+		}
+	}
+	return ErrSignatureDoesNotMatch
+}
+
+// parseAuthorizationHeader reads "AWS4-HMAC-SHA256 Credential=..., SignedHeaders=..., Signature=..."
+func parseAuthorizationHeader(authorization string, request *http.Request) (*signature, error) {
+	if !strings.HasPrefix(authorization, algorithm+" ") {
+		return nil, ErrIncompleteSignature.WithMessage("Unsupported authorization algorithm, only " + algorithm + " is supported")
+	}
+	fields := make(map[string]string)
+	for _, field := range strings.Split(strings.TrimPrefix(authorization, algorithm+" "), ",") {
+		parts := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(parts) == 2 {
+			fields[parts[0]] = parts[1]
+		}
+	}
+	amzDate := request.Header.Get("X-Amz-Date")
+	if amzDate == "" {
+		if date, err := http.ParseTime(request.Header.Get("Date")); err == nil {
+			amzDate = date.UTC().Format(timeFormat)
+		}
+	}
+	return newSignature(fields["Credential"], fields["SignedHeaders"], fields["Signature"], amzDate)
+}
+
+// parseQuerySignature reads the X-Amz-* parameters of a presigned URL
+func parseQuerySignature(query url.Values) (*signature, error) {
+	if query.Get("X-Amz-Algorithm") != algorithm {
+		return nil, ErrIncompleteSignature.WithMessage("Unsupported X-Amz-Algorithm, only " + algorithm + " is supported")
+	}
+	sig, err := newSignature(query.Get("X-Amz-Credential"), query.Get("X-Amz-SignedHeaders"), query.Get("X-Amz-Signature"), query.Get("X-Amz-Date"))
+	if err != nil {
+		return nil, err
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expires < 1 || expires > 604800 {
+		return nil, ErrIncompleteSignature.WithMessage("X-Amz-Expires must be between 1 and 604800 seconds")
+	}
+	sig.expires = time.Duration(expires) * time.Second
+	sig.presigned = true
+	return sig, nil
+}
+
+func newSignature(credential string, signedHeaders string, sig string, amzDate string) (*signature, error) {
+	credentialParts := strings.SplitN(credential, "/", 2)
+	if len(credentialParts) != 2 || signedHeaders == "" || sig == "" || amzDate == "" {
+		return nil, ErrIncompleteSignature
+	}
+	scope := strings.Split(credentialParts[1], "/")
+	if len(scope) != 4 || scope[3] != "aws4_request" {
+		return nil, ErrIncompleteSignature.WithMessage("Credential should be scoped with a valid terminator: 'aws4_request'")
+	}
+	headers := strings.Split(strings.ToLower(signedHeaders), ";")
+	if !containsString(headers, "host") {
+		return nil, ErrSignatureDoesNotMatch.WithMessage("'Host' or ':authority' must be a 'SignedHeader' in the AWS Authorization.")
+	}
+	return &signature{
+		accessKeyId:   credentialParts[0],
+		scope:         credentialParts[1],
+		date:          scope[0],
+		amzDate:       amzDate,
+		signedHeaders: headers,
+		signature:     sig}, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// readBody returns the request body and puts it back so the handlers can still parse it
+func readBody(request *http.Request) ([]byte, error) {
+	if request.Body == nil {
+		return []byte{}, nil
+	}
+	body, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		return nil, err
+	}
+	request.Body.Close()
+	request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+func buildCanonicalRequest(request *http.Request, signedHeaders []string, payloadHash string) string {
+	headers := make([]string, 0, len(signedHeaders))
+	for _, name := range signedHeaders {
+		headers = append(headers, name+":"+canonicalHeaderValue(request, name))
+	}
+	return strings.Join([]string{
+		request.Method,
+		canonicalURI(request.URL),
+		canonicalQueryString(request.URL.Query()),
+		strings.Join(headers, "\n") + "\n",
+		strings.Join(signedHeaders, ";"),
+		payloadHash}, "\n")
+}
+
+func canonicalHeaderValue(request *http.Request, name string) string {
+	var values []string
+	switch name {
+	case "host":
+		values = []string{request.Host}
+	case "content-length":
+		values = request.Header[http.CanonicalHeaderKey(name)]
+		if len(values) == 0 {
+			values = []string{strconv.FormatInt(request.ContentLength, 10)}
+		}
+	default:
+		values = request.Header[http.CanonicalHeaderKey(name)]
+	}
+	trimmed := make([]string, 0, len(values))
+	for _, value := range values {
+		trimmed = append(trimmed, strings.Join(strings.Fields(value), " "))
+	}
+	return strings.Join(trimmed, ",")
+}
+
+// canonicalURI encodes the already escaped path once more, as the SDKs do for every service but S3
+func canonicalURI(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+	return uriEncode(path, false)
+}
+
+func canonicalQueryString(query url.Values) string {
+	pairs := []string{}
+	for key, values := range query {
+		if key == "X-Amz-Signature" {
+			continue
+		}
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent encodes every byte except the RFC 3986 unreserved characters, and "/" unless encodeSlash is set
+func uriEncode(value string, encodeSlash bool) string {
+	var encoded bytes.Buffer
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !encodeSlash {
+			encoded.WriteByte(c)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+	return encoded.String()
+}
+
+func deriveSigningKey(secret string, scope string) []byte {
+	key := []byte("AWS4" + secret)
+	for _, part := range strings.Split(scope, "/") {
+		key = hmacSHA256(key, part)
+	}
+	return key
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hashHex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"context"
 	"crypto/md5"
 	"crypto/rand"
 	"encoding/binary"
@@ -11,19 +12,16 @@ import (
 	"hash"
 	"io"
 	"io/ioutil"
-	"os"
+	"net/http"
+	"reflect"
 	"sort"
 
 	log "github.com/sirupsen/logrus"
 )
 
-var LogMessages bool
-var LogFile string
-
 type (
 	Protocol         string
 	MessageStructure string
-	ErrorHandler     map[string]ErrorType
 )
 
 const (
@@ -51,16 +49,18 @@ func GetMD5Hash(text string) string {
 	return hex.EncodeToString(hasher.Sum(nil))
 }
 
-func LogMessage(msg string) {
-	if _, err := os.Stat(LogFile); os.IsNotExist(err) {
-		_, err := os.Create("/tmp/dat2")
-		if err != nil {
-			log.Println("could not create log file:", LogFile)
-			return
-		}
+// MessageLog writes messages to a file when enabled
+type MessageLog struct {
+	Enabled bool
+	File    string
+}
+
+func (l *MessageLog) LogMessage(msg string) {
+	if !l.Enabled {
+		return
 	}
-	if LogMessages == true {
-		ioutil.WriteFile(LogFile, []byte(msg), 0644)
+	if err := ioutil.WriteFile(l.File, []byte(msg), 0644); err != nil {
+		log.Println("could not write log file:", l.File)
 	}
 }
 
@@ -91,29 +91,58 @@ func AddBytesToHash(hasher hash.Hash, arr []byte) {
 	hasher.Write(arr)
 }
 
+// SortKeys returns the sorted keys of a map with string keys
 func SortKeys(a interface{}) []string {
-	attributes := make(map[string]interface{})
 	var keys []string
-	for key, _ := range attributes {
-		keys = append(keys, key)
+	value := reflect.ValueOf(a)
+	if value.Kind() != reflect.Map {
+		return keys
+	}
+	for _, key := range value.MapKeys() {
+		keys = append(keys, key.String())
 	}
 	sort.Strings(keys)
 	return keys
 }
 
 /*** Common ***/
+
+// JSONResponse is implemented by responses which can be sent with the AWS JSON protocol
+type JSONResponse interface {
+	JSONResult() interface{}
+}
+
 type ResponseMetadata struct {
 	RequestId string `xml:"RequestId"`
 }
 
+type requestIdKey struct{}
+
+// WithRequestId returns the request carrying the ID the response reports in its ResponseMetadata
+func WithRequestId(request *http.Request, requestId string) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), requestIdKey{}, requestId))
+}
+
+// RequestId returns the ID given to the request with WithRequestId, or an empty string
+func RequestId(request *http.Request) string {
+	requestId, _ := request.Context().Value(requestIdKey{}).(string)
+	return requestId
+}
+
 /*** Error Responses ***/
 type ErrorResult struct {
-	Type      string `xml:"Type,omitempty"`
-	Code      string `xml:"Code,omitempty"`
-	Message   string `xml:"Message,omitempty"`
-	RequestId string `xml:"RequestId,omitempty"`
+	Type    string `xml:"Type,omitempty"`
+	Code    string `xml:"Code,omitempty"`
+	Message string `xml:"Message,omitempty"`
 }
 
+// JSONErrorResponse is the error body of the AWS JSON protocol
+type JSONErrorResponse struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+// ErrorType is an AWS error, handlers return it and the router sends its code, message and status
 type ErrorType struct {
 	HttpError int
 	Type      string
@@ -121,6 +150,44 @@ type ErrorType struct {
 	Message   string
 }
 
+func (e *ErrorType) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// WithMessage returns a copy of the error carrying a more specific message
+func (e *ErrorType) WithMessage(message string) *ErrorType {
+	copy := *e
+	copy.Message = message
+	return &copy
+}
+
+// SenderFault reports whether the error was caused by the request rather than the service
+func (e *ErrorType) SenderFault() bool {
+	return e.Type == "Sender"
+}
+
+// ToErrorType returns the AWS error for err, errors which are not an ErrorType are internal failures
+func ToErrorType(err error) *ErrorType {
+	if e, ok := err.(*ErrorType); ok {
+		return e
+	}
+	return ErrInternalFailure
+}
+
+var (
+	ErrInternalFailure = &ErrorType{
+		HttpError: http.StatusInternalServerError,
+		Type:      "Receiver",
+		Code:      "InternalFailure",
+		Message:   "The request processing has failed because of an unknown error, exception or failure."}
+	ErrInvalidAction = &ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "InvalidAction",
+		Message:   "The action or operation requested is invalid. Verify that the action is typed correctly."}
+)
+
 type ErrorResponse struct {
-	Result ErrorResult `xml:"Error"`
+	Result    ErrorResult `xml:"Error"`
+	RequestId string      `xml:"RequestId"`
 }
@@ -24,3 +24,10 @@ func TestGetMD5Hash(t *testing.T) {
 		t.Errorf("hashs and hash2 are the same, but should not be")
 	}
 }
+
+func TestSortKeys(t *testing.T) {
+	keys := SortKeys(map[string]int{"b": 2, "c": 3, "a": 1})
+	if len(keys) != 3 || keys[0] != "a" || keys[1] != "b" || keys[2] != "c" {
+		t.Errorf("keys should be sorted, got %v", keys)
+	}
+}
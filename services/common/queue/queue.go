@@ -1,17 +1,24 @@
 package queue
 
 import (
+	"container/list"
 	"errors"
 	"sync"
+	"time"
 )
 
 type Compare func(interface{}, interface{}) bool
 
-// BlockingQueue is a FIFO queue where Pop() operation is blocking if no items exists
+// Key returns the keys an item can be looked up by. The keys of an item must not change while it is queued
+type Key func(interface{}) []string
+
+// BlockingQueue is a FIFO queue whose readers can wait for changes. It is safe for concurrent use
 type BlockingQueue struct {
 	closed bool
 	lock   sync.Mutex
-	queue  []interface{}
+	queue  *list.List
+	key    Key
+	index  map[string]*list.Element
 
 	notifyLock sync.Mutex
 	monitor    *sync.Cond
@@ -19,96 +26,207 @@ type BlockingQueue struct {
 
 // New instance of FIFO queue
 func New() *BlockingQueue {
-	bq := &BlockingQueue{}
+	return NewIndexed(nil)
+}
+
+// NewIndexed returns a FIFO queue whose items can be found by the keys key returns in constant time
+func NewIndexed(key Key) *BlockingQueue {
+	bq := &BlockingQueue{queue: list.New(), key: key, index: make(map[string]*list.Element)}
 	bq.monitor = sync.NewCond(&bq.notifyLock)
 	return bq
 }
 
 // Put any value to queue back. Returns false if queue closed
 func (bq *BlockingQueue) Put(value interface{}) bool {
+	bq.lock.Lock()
 	if bq.closed {
+		bq.lock.Unlock()
 		return false
 	}
+	bq.insert(value, bq.queue.PushBack(value))
+	bq.lock.Unlock()
+
+	bq.notify()
+	return true
+}
+
+// PutSorted inserts value before the first item it is less than, keeping a sorted queue sorted.
+// Returns false if queue closed
+func (bq *BlockingQueue) PutSorted(value interface{}, less Compare) bool {
 	bq.lock.Lock()
 	if bq.closed {
+		bq.lock.Unlock()
 		return false
 	}
-	bq.queue = append(bq.queue, value)
+	// items mostly arrive in order, so the position is searched from the back
+	e := bq.queue.Back()
+	for e != nil && less(value, e.Value) {
+		e = e.Prev()
+	}
+	if e == nil {
+		bq.insert(value, bq.queue.PushFront(value))
+	} else {
+		bq.insert(value, bq.queue.InsertAfter(value, e))
+	}
 	bq.lock.Unlock()
 
+	bq.notify()
+	return true
+}
+
+// Wait blocks until ready returns true, the timeout elapses or done is closed.
+// ready is re-evaluated every time the queue changes. Returns the last result of ready.
+func (bq *BlockingQueue) Wait(timeout time.Duration, done <-chan struct{}, ready func() bool) bool {
+	expired := false
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-done:
+		case <-stop:
+			return
+		}
+		bq.notifyLock.Lock()
+		expired = true
+		bq.monitor.Broadcast()
+		bq.notifyLock.Unlock()
+	}()
+
 	bq.notifyLock.Lock()
-	bq.monitor.Signal()
-	bq.notifyLock.Unlock()
+	defer bq.notifyLock.Unlock()
+	for !ready() {
+		if expired || bq.Closed() {
+			return false
+		}
+		bq.monitor.Wait()
+	}
 	return true
 }
 
+// Remove deletes the first item equal to value. Returns false if there is none
 func (bq *BlockingQueue) Remove(value interface{}, equal Compare) bool {
-	for i, src := range bq.queue {
-		if equal(src, value) == true {
-			if bq.closed {
-				return false
-			}
-			bq.lock.Lock()
-			if bq.closed {
-				return false
-			}
-			bq.queue = append(bq.queue[:i], bq.queue[i+1:]...)
-			bq.lock.Unlock()
-			bq.notifyLock.Lock()
-			bq.monitor.Signal()
-			bq.notifyLock.Unlock()
-			return true
-		}
+	bq.lock.Lock()
+	e := bq.find(value, equal)
+	if e != nil {
+		bq.remove(e)
 	}
-	return false
+	bq.lock.Unlock()
+
+	if e == nil {
+		return false
+	}
+	bq.notify()
+	return true
 }
 
+// Get returns the first item equal to value, or nil
 func (bq *BlockingQueue) Get(value interface{}, equal Compare) interface{} {
-	for _, src := range bq.queue {
-		if equal(src, value) == true {
-			if bq.closed {
-				return nil
-			}
-			return src
-		}
+	bq.lock.Lock()
+	defer bq.lock.Unlock()
+	if e := bq.find(value, equal); e != nil {
+		return e.Value
 	}
 	return nil
 }
 
-func (bq *BlockingQueue) Iterator() <-chan interface{} {
-	channel := make(chan interface{})
-	go func() {
-		for _, val := range bq.queue {
-			channel <- val
+// GetKey returns the item with the key, or nil
+func (bq *BlockingQueue) GetKey(key string) interface{} {
+	bq.lock.Lock()
+	defer bq.lock.Unlock()
+	if e, ok := bq.index[key]; ok {
+		return e.Value
+	}
+	return nil
+}
+
+// RemoveKey deletes the item with the key and returns it, or nil if there is none
+func (bq *BlockingQueue) RemoveKey(key string) interface{} {
+	bq.lock.Lock()
+	e, ok := bq.index[key]
+	if ok {
+		bq.remove(e)
+	}
+	bq.lock.Unlock()
+
+	if !ok {
+		return nil
+	}
+	bq.notify()
+	return e.Value
+}
+
+// Replace swaps the item with the key for value, which must have the same keys, keeping its position.
+// Returns false if there is no such item
+func (bq *BlockingQueue) Replace(key string, value interface{}) bool {
+	bq.lock.Lock()
+	e, ok := bq.index[key]
+	if ok {
+		e.Value = value
+	}
+	bq.lock.Unlock()
+
+	if ok {
+		bq.notify()
+	}
+	return ok
+}
+
+// Items returns a copy of the items in queue order
+func (bq *BlockingQueue) Items() []interface{} {
+	bq.lock.Lock()
+	defer bq.lock.Unlock()
+	items := make([]interface{}, 0, bq.queue.Len())
+	for e := bq.queue.Front(); e != nil; e = e.Next() {
+		items = append(items, e.Value)
+	}
+	return items
+}
+
+// Scan calls fn for the items in queue order until it returns false. fn must not use the queue
+func (bq *BlockingQueue) Scan(fn func(interface{}) bool) {
+	bq.lock.Lock()
+	defer bq.lock.Unlock()
+	for e := bq.queue.Front(); e != nil; e = e.Next() {
+		if !fn(e.Value) {
+			return
 		}
-		close(channel)
-	}()
+	}
+}
+
+// Iterator returns the items queued when it is called. Changes made while iterating are not seen
+func (bq *BlockingQueue) Iterator() <-chan interface{} {
+	items := bq.Items()
+	channel := make(chan interface{}, len(items))
+	for _, item := range items {
+		channel <- item
+	}
+	close(channel)
 	return channel
 }
 
-// Pop front value from queue. Returns nil and false if queue closed
+// Pop front value from queue. Returns nil if queue closed or empty
 func (bq *BlockingQueue) Pop() interface{} {
-	var output interface{}
-	if bq.closed {
-		return nil
-	}
 	bq.lock.Lock()
-	if bq.closed {
+	e := bq.queue.Front()
+	if bq.closed || e == nil {
+		bq.lock.Unlock()
 		return nil
 	}
-	output, bq.queue = bq.queue[len(bq.queue)-1], bq.queue[:len(bq.queue)-1]
+	bq.remove(e)
 	bq.lock.Unlock()
-	bq.notifyLock.Lock()
-	bq.monitor.Signal()
-	bq.notifyLock.Unlock()
-	return output
+
+	bq.notify()
+	return e.Value
 }
 
 // Size of queue. Performance is O(1)
 func (bq *BlockingQueue) Size() int {
 	bq.lock.Lock()
 	defer bq.lock.Unlock()
-	return len(bq.queue)
+	return bq.queue.Len()
 }
 
 // Closed flag
@@ -122,26 +240,75 @@ func (bq *BlockingQueue) Closed() bool {
 // Also notifies all reader (they will return nil and false)
 // Returns error if queue already closed
 func (bq *BlockingQueue) Close() error {
+	bq.lock.Lock()
 	if bq.closed {
+		bq.lock.Unlock()
 		return errors.New("Already closed")
 	}
 	bq.closed = true
-	bq.lock.Lock()
-	//Clear
-	bq.queue = bq.queue[:0]
+	bq.clear()
 	bq.lock.Unlock()
-	bq.monitor.Broadcast()
+
+	bq.notify()
 	return nil
 }
 
+// Empty removes every item from the queue
 func (bq *BlockingQueue) Empty() error {
+	bq.lock.Lock()
 	if bq.closed {
+		bq.lock.Unlock()
 		return nil
 	}
-	bq.lock.Lock()
-	//Clear
-	bq.queue = bq.queue[:0]
+	bq.clear()
 	bq.lock.Unlock()
+
+	bq.notify()
+	return nil
+}
+
+// notify wakes up the readers waiting for a change, bq.lock must not be held
+func (bq *BlockingQueue) notify() {
+	bq.notifyLock.Lock()
 	bq.monitor.Broadcast()
+	bq.notifyLock.Unlock()
+}
+
+// find returns the element of the first item equal to value, bq.lock must be held
+func (bq *BlockingQueue) find(value interface{}, equal Compare) *list.Element {
+	for e := bq.queue.Front(); e != nil; e = e.Next() {
+		if equal(e.Value, value) {
+			return e
+		}
+	}
 	return nil
 }
+
+// insert indexes a new element, bq.lock must be held
+func (bq *BlockingQueue) insert(value interface{}, e *list.Element) {
+	if bq.key == nil {
+		return
+	}
+	for _, key := range bq.key(value) {
+		bq.index[key] = e
+	}
+}
+
+// remove unlinks an element and its keys, bq.lock must be held
+func (bq *BlockingQueue) remove(e *list.Element) {
+	bq.queue.Remove(e)
+	if bq.key == nil {
+		return
+	}
+	for _, key := range bq.key(e.Value) {
+		if bq.index[key] == e {
+			delete(bq.index, key)
+		}
+	}
+}
+
+// clear removes every element, bq.lock must be held
+func (bq *BlockingQueue) clear() {
+	bq.queue.Init()
+	bq.index = make(map[string]*list.Element)
+}
@@ -0,0 +1,159 @@
+package queue
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+type item struct {
+	id    string
+	order int
+}
+
+func itemKey(v interface{}) []string {
+	return []string{v.(*item).id}
+}
+
+func itemLess(v interface{}, other interface{}) bool {
+	return v.(*item).order < other.(*item).order
+}
+
+func ids(bq *BlockingQueue) string {
+	s := ""
+	for v := range bq.Iterator() {
+		s += v.(*item).id
+	}
+	return s
+}
+
+func TestBlockingQueue_FIFO(t *testing.T) {
+	bq := New()
+	for i := 0; i < 3; i++ {
+		bq.Put(i)
+	}
+	for i := 0; i < 3; i++ {
+		if v := bq.Pop(); v != i {
+			t.Errorf("expected %d, got %v", i, v)
+		}
+	}
+	if v := bq.Pop(); v != nil {
+		t.Errorf("expected nil from an empty queue, got %v", v)
+	}
+}
+
+func TestBlockingQueue_PutSorted(t *testing.T) {
+	bq := New()
+	for _, i := range []int{3, 1, 4, 1, 5, 2} {
+		bq.PutSorted(&item{id: strconv.Itoa(i), order: i}, itemLess)
+	}
+	if s := ids(bq); s != "112345" {
+		t.Errorf("expected 112345, got %s", s)
+	}
+}
+
+func TestBlockingQueue_Indexed(t *testing.T) {
+	bq := NewIndexed(itemKey)
+	a, b, c := &item{id: "a"}, &item{id: "b"}, &item{id: "c"}
+	bq.Put(a)
+	bq.Put(b)
+	bq.Put(c)
+
+	if v := bq.GetKey("b"); v != b {
+		t.Errorf("expected b, got %v", v)
+	}
+	if v := bq.RemoveKey("b"); v != b {
+		t.Errorf("expected to remove b, got %v", v)
+	}
+	if v := bq.GetKey("b"); v != nil {
+		t.Errorf("expected b to be gone, got %v", v)
+	}
+	if v := bq.RemoveKey("b"); v != nil {
+		t.Errorf("expected nothing to remove, got %v", v)
+	}
+	if v := bq.Pop(); v != a {
+		t.Errorf("expected a, got %v", v)
+	}
+	if v := bq.GetKey("a"); v != nil {
+		t.Errorf("expected popped a to be unindexed, got %v", v)
+	}
+	updated := &item{id: "c", order: 1}
+	if !bq.Replace("c", updated) || bq.GetKey("c") != updated || bq.Size() != 1 {
+		t.Errorf("expected c to be replaced in place")
+	}
+	if bq.Replace("b", b) {
+		t.Error("expected nothing to replace")
+	}
+	bq.Empty()
+	if v := bq.GetKey("c"); v != nil || bq.Size() != 0 {
+		t.Errorf("expected an empty queue, got %v and size %d", v, bq.Size())
+	}
+}
+
+func TestBlockingQueue_RemoveGet(t *testing.T) {
+	bq := New()
+	bq.Put("a")
+	bq.Put("b")
+	equal := func(src interface{}, value interface{}) bool { return src == value }
+	if v := bq.Get("b", equal); v != "b" {
+		t.Errorf("expected b, got %v", v)
+	}
+	if !bq.Remove("a", equal) || bq.Remove("a", equal) {
+		t.Error("expected a to be removed once")
+	}
+	if bq.Size() != 1 {
+		t.Errorf("expected 1 item, got %d", bq.Size())
+	}
+}
+
+func TestBlockingQueue_Scan(t *testing.T) {
+	bq := New()
+	for i := 0; i < 5; i++ {
+		bq.Put(i)
+	}
+	var seen []int
+	bq.Scan(func(v interface{}) bool {
+		seen = append(seen, v.(int))
+		return len(seen) < 3
+	})
+	if len(seen) != 3 || seen[0] != 0 || seen[2] != 2 {
+		t.Errorf("expected to stop after 0 1 2, got %v", seen)
+	}
+}
+
+func TestBlockingQueue_Close(t *testing.T) {
+	bq := New()
+	bq.Put(1)
+	if err := bq.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bq.Close(); err == nil {
+		t.Error("expected an error closing twice")
+	}
+	if bq.Put(2) || bq.PutSorted(2, func(interface{}, interface{}) bool { return false }) {
+		t.Error("expected Put to fail on a closed queue")
+	}
+	if v := bq.Pop(); v != nil || bq.Size() != 0 {
+		t.Errorf("expected a closed queue to be empty, got %v", v)
+	}
+}
+
+func TestBlockingQueue_Wait(t *testing.T) {
+	bq := New()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		bq.Put(1)
+	}()
+	if !bq.Wait(5*time.Second, nil, func() bool { return bq.Size() > 0 }) {
+		t.Error("expected Wait to return once an item was put")
+	}
+	if bq.Wait(10*time.Millisecond, nil, func() bool { return bq.Size() > 1 }) {
+		t.Error("expected Wait to time out")
+	}
+
+	done := make(chan struct{})
+	close(done)
+	if bq.Wait(time.Minute, done, func() bool { return false }) {
+		t.Error("expected Wait to return when done is closed")
+	}
+}
@@ -0,0 +1,180 @@
+package queue
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// The stress tests are meant to be run with -race, they hammer a queue from many goroutines at once
+
+const (
+	producers = 8
+	consumers = 8
+	perWorker = 2000
+)
+
+func TestStress_ProducersConsumers(t *testing.T) {
+	bq := NewIndexed(itemKey)
+	var popped int64
+	seen := make([]int32, producers*perWorker)
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				n := p*perWorker + i
+				if !bq.Put(&item{id: strconv.Itoa(n), order: n}) {
+					t.Error("Put failed on an open queue")
+				}
+			}
+		}(p)
+	}
+	for c := 0; c < consumers; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt64(&popped) < producers*perWorker {
+				if v := bq.Pop(); v != nil {
+					atomic.AddInt32(&seen[v.(*item).order], 1)
+					atomic.AddInt64(&popped, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for n, count := range seen {
+		if count != 1 {
+			t.Fatalf("item %d was popped %d times", n, count)
+		}
+	}
+	if bq.Size() != 0 || bq.GetKey("0") != nil {
+		t.Errorf("expected an empty queue and index, got size %d", bq.Size())
+	}
+}
+
+func TestStress_RemoveKey(t *testing.T) {
+	bq := NewIndexed(itemKey)
+	total := producers * perWorker
+	for n := 0; n < total; n++ {
+		bq.Put(&item{id: strconv.Itoa(n), order: n})
+	}
+
+	// every key is removed by two goroutines, only one of them may get the item
+	var removed int64
+	var wg sync.WaitGroup
+	for w := 0; w < 2*consumers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for n := w % consumers; n < total; n += consumers {
+				if bq.RemoveKey(strconv.Itoa(n)) != nil {
+					atomic.AddInt64(&removed, 1)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	if removed != int64(total) || bq.Size() != 0 {
+		t.Errorf("expected %d removals and an empty queue, got %d and size %d", total, removed, bq.Size())
+	}
+}
+
+func TestStress_IterateWhileMutating(t *testing.T) {
+	bq := NewIndexed(itemKey)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	for w := 0; w < producers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				n := w*perWorker + i%perWorker
+				bq.PutSorted(&item{id: strconv.Itoa(n), order: n}, itemLess)
+				bq.RemoveKey(strconv.Itoa(n))
+				bq.Get(n, func(src interface{}, value interface{}) bool { return src.(*item).order == value.(int) })
+			}
+		}(w)
+	}
+	for w := 0; w < consumers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				for v := range bq.Iterator() {
+					if v.(*item).id == "" {
+						t.Error("iterated over a broken item")
+					}
+					// leaving early must not leak the iterator
+					break
+				}
+				bq.Size()
+			}
+		}()
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+}
+
+func TestStress_WaitersAndClose(t *testing.T) {
+	bq := New()
+	var woken int64
+	var wg sync.WaitGroup
+
+	for c := 0; c < consumers; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !bq.Closed() {
+				ready := bq.Wait(time.Second, nil, func() bool { return bq.Size() > 0 })
+				if ready && bq.Pop() != nil {
+					atomic.AddInt64(&woken, 1)
+				}
+			}
+		}()
+	}
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker/10; i++ {
+				bq.Put(i)
+			}
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	bq.Close()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiters did not return after the queue was closed")
+	}
+	if woken == 0 {
+		t.Error("expected waiters to pop items")
+	}
+}
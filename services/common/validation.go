@@ -0,0 +1,113 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxMessageSize is the largest message body plus message attributes SQS and SNS accept
+	MaxMessageSize = 262144
+	// MaxMessageAttributes is the number of message attributes a message can carry
+	MaxMessageAttributes = 10
+	// MaxMessageAttributeNameLength bounds message attribute names and data types
+	MaxMessageAttributeNameLength = 256
+)
+
+func isNameCharacter(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_'
+}
+
+// validateName checks a queue or topic name: alphanumeric characters, hyphens and underscores, FIFO names end with .fifo
+func validateName(name string, maxLength int) error {
+	if len(name) == 0 || len(name) > maxLength {
+		return fmt.Errorf("Name must be 1 to %d characters long", maxLength)
+	}
+	if strings.TrimSuffix(name, ".fifo") == "" {
+		return errors.New("Name can not be empty")
+	}
+	for _, r := range strings.TrimSuffix(name, ".fifo") {
+		if !isNameCharacter(r) {
+			return errors.New("Name can only include alphanumeric characters, hyphens, or underscores")
+		}
+	}
+	return nil
+}
+
+// ValidateQueueName checks a queue name: up to 80 alphanumeric characters, hyphens and underscores
+func ValidateQueueName(name string) error {
+	return validateName(name, 80)
+}
+
+// ValidateTopicName checks a topic name: up to 256 alphanumeric characters, hyphens and underscores
+func ValidateTopicName(name string) error {
+	return validateName(name, 256)
+}
+
+// IsValidMessageCharacter reports whether a character is allowed in a message:
+// #x9 | #xA | #xD | #x20 to #xD7FF | #xE000 to #xFFFD | #x10000 to #x10FFFF
+func IsValidMessageCharacter(r rune) bool {
+	return r == 0x9 || r == 0xA || r == 0xD ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= 0x10FFFF
+}
+
+// ValidateMessageBody checks that a message body only contains allowed characters
+func ValidateMessageBody(body string) error {
+	if !utf8.ValidString(body) {
+		return errors.New("The message body is not valid UTF-8")
+	}
+	for _, r := range body {
+		if !IsValidMessageCharacter(r) {
+			return fmt.Errorf("Invalid binary character '#x%X' was found in the message body, the set of allowed characters is #x9 | #xA | #xD | #x20 to #xD7FF | #xE000 to #xFFFD | #x10000 to #x10FFFF", r)
+		}
+	}
+	return nil
+}
+
+// ValidateMessageAttributeName checks a message attribute name: up to 256 alphanumeric characters, hyphens,
+// underscores and periods, without leading, trailing or consecutive periods and not starting with AWS. or Amazon.
+func ValidateMessageAttributeName(name string) error {
+	if len(name) == 0 || len(name) > MaxMessageAttributeNameLength {
+		return fmt.Errorf("Message attribute name must be 1 to %d characters long", MaxMessageAttributeNameLength)
+	}
+	for _, r := range name {
+		if !isNameCharacter(r) && r != '.' {
+			return fmt.Errorf("Message attribute name '%s' contains an invalid character", name)
+		}
+	}
+	if strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".") || strings.Contains(name, "..") {
+		return fmt.Errorf("Message attribute name '%s' can not start or end with a period, or have consecutive periods", name)
+	}
+	lower := strings.ToLower(name)
+	if strings.HasPrefix(lower, "aws.") || strings.HasPrefix(lower, "amazon.") {
+		return fmt.Errorf("Message attribute name '%s' can not start with AWS. or Amazon.", name)
+	}
+	return nil
+}
+
+// ValidateMessageAttributeValue checks the data type of a message attribute, String, Number or Binary with an
+// optional custom type (e.g.: Number.float), and that Number values are numbers
+func ValidateMessageAttributeValue(name string, dataType string, value string) error {
+	if len(dataType) > MaxMessageAttributeNameLength {
+		return fmt.Errorf("Message attribute '%s' data type must be at most %d characters long", name, MaxMessageAttributeNameLength)
+	}
+	if value == "" {
+		return fmt.Errorf("The message attribute '%s' must contain non-empty message attribute value", name)
+	}
+	baseType := strings.SplitN(dataType, ".", 2)[0]
+	switch baseType {
+	case "String", "Binary":
+	case "Number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return fmt.Errorf("Could not cast message attribute '%s' value to number", name)
+		}
+	default:
+		return fmt.Errorf("The message attribute '%s' has an invalid message attribute type, the set of supported type prefixes is Binary, Number, and String", name)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package common
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateQueueName(t *testing.T) {
+	for _, name := range []string{"queue", "my-queue_1", "orders.fifo", strings.Repeat("a", 80)} {
+		if err := ValidateQueueName(name); err != nil {
+			t.Errorf("expected %q to be valid, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "my queue", "queue.name", ".fifo", strings.Repeat("a", 81)} {
+		if err := ValidateQueueName(name); err == nil {
+			t.Errorf("expected %q to be invalid", name)
+		}
+	}
+}
+
+func TestValidateTopicName(t *testing.T) {
+	if err := ValidateTopicName(strings.Repeat("a", 256)); err != nil {
+		t.Errorf("expected a 256 character name to be valid, got %v", err)
+	}
+	if err := ValidateTopicName(strings.Repeat("a", 257)); err == nil {
+		t.Errorf("expected a 257 character name to be invalid")
+	}
+}
+
+func TestValidateMessageBody(t *testing.T) {
+	for _, body := range []string{"hello", "tab\tand\nnewline\r", "unicode ⌘ \U0001F600"} {
+		if err := ValidateMessageBody(body); err != nil {
+			t.Errorf("expected %q to be valid, got %v", body, err)
+		}
+	}
+	for _, body := range []string{"null \x00", "bell \x07", "invalid \xff utf8", "noncharacter ￾"} {
+		if err := ValidateMessageBody(body); err == nil {
+			t.Errorf("expected %q to be invalid", body)
+		}
+	}
+}
+
+func TestValidateMessageAttributeName(t *testing.T) {
+	for _, name := range []string{"trace", "trace.id", "Trace-Id_2"} {
+		if err := ValidateMessageAttributeName(name); err != nil {
+			t.Errorf("expected %q to be valid, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "trace id", ".trace", "trace.", "trace..id", "AWS.trace", "amazon.trace", strings.Repeat("a", 257)} {
+		if err := ValidateMessageAttributeName(name); err == nil {
+			t.Errorf("expected %q to be invalid", name)
+		}
+	}
+}
+
+func TestValidateMessageAttributeValue(t *testing.T) {
+	valid := [][2]string{{"String", "abc"}, {"Number", "12.5"}, {"Number.int", "-3"}, {"Binary", "AQID"}, {"String.custom", "x"}}
+	for _, v := range valid {
+		if err := ValidateMessageAttributeValue("name", v[0], v[1]); err != nil {
+			t.Errorf("expected %s %q to be valid, got %v", v[0], v[1], err)
+		}
+	}
+	invalid := [][2]string{{"String", ""}, {"Number", "twelve"}, {"Text", "abc"}, {"String." + strings.Repeat("a", 256), "abc"}}
+	for _, v := range invalid {
+		if err := ValidateMessageAttributeValue("name", v[0], v[1]); err == nil {
+			t.Errorf("expected %s %q to be invalid", v[0], v[1])
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package emulator
+
+import (
+	"net/http"
+
+	"github.com/Tweddle-SE-Team/goaws/services/snapshot"
+)
+
+type ImportSnapshotResponse struct {
+	Queues int
+	Topics int
+}
+
+// Snapshot captures the state of every queue and topic
+func (e *Emulator) Snapshot() *snapshot.Snapshot {
+	return snapshot.Take(e.SQS, e.SNS)
+}
+
+// Restore replaces the state of every queue and topic with the snapshot
+func (e *Emulator) Restore(s *snapshot.Snapshot) {
+	s.Restore(e.SQS, e.SNS)
+}
+
+// ExportSnapshot returns the state of every queue and topic
+func (e *Emulator) ExportSnapshot(request *http.Request) (interface{}, string, error) {
+	return e.Snapshot(), "JSON", nil
+}
+
+// ImportSnapshot replaces the state of every queue and topic with the snapshot in the request body
+func (e *Emulator) ImportSnapshot(request *http.Request) (interface{}, string, error) {
+	s, err := snapshot.Read(request.Body)
+	if err != nil {
+		return nil, "JSON", snapshot.ErrInvalidSnapshot.WithMessage("The snapshot could not be read: " + err.Error())
+	}
+	e.Restore(s)
+	return &ImportSnapshotResponse{Queues: len(s.Queues), Topics: len(s.Topics)}, "JSON", nil
+}
@@ -0,0 +1,133 @@
+package emulator
+
+import (
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/Tweddle-SE-Team/goaws/config"
+	"github.com/Tweddle-SE-Team/goaws/services/auth"
+	"github.com/Tweddle-SE-Team/goaws/services/common"
+	"github.com/Tweddle-SE-Team/goaws/services/sns"
+	"github.com/Tweddle-SE-Team/goaws/services/sqs"
+	"github.com/Tweddle-SE-Team/goaws/services/storage"
+)
+
+// Emulator is an isolated SQS and SNS fake: every instance has its own queues, topics, credentials and storage
+type Emulator struct {
+	SQS        *sqs.SQS
+	SNS        *sns.SNS
+	Auth       *auth.Verifier
+	MessageLog *common.MessageLog
+	store      storage.Store
+	lock       sync.Mutex
+}
+
+// New returns an emulator without queues or topics which keeps its state in memory and accepts unsigned requests
+func New() *Emulator {
+	sqsService := sqs.NewSQS()
+	return &Emulator{
+		SQS:        sqsService,
+		SNS:        sns.NewSNS(sqsService),
+		Auth:       auth.NewVerifier(),
+		MessageLog: &common.MessageLog{}}
+}
+
+// NewFromConfig returns an emulator set up with an environment of the config file
+func NewFromConfig(env *config.Environment) (*Emulator, error) {
+	e := New()
+	if err := e.Configure(env); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Configure applies an environment: message logging, credentials, storage, then the queues and topics it lists.
+// Queues and topics restored from storage keep their state, only missing ones are created.
+func (e *Emulator) Configure(env *config.Environment) error {
+	e.MessageLog.Enabled = env.LogMessages
+	e.MessageLog.File = env.MessageLogFile()
+
+	credentials := make(map[string]string)
+	for _, credential := range env.Credentials {
+		credentials[credential.AccessKeyId] = credential.SecretAccessKey
+	}
+	e.Auth.SetCredentials(credentials)
+
+	store, err := storage.Open(env.Storage, env.StorageFile())
+	if err != nil {
+		return err
+	}
+	if err := e.SetStore(store); err != nil {
+		return err
+	}
+
+	queueHost := env.Host + ":" + env.Ports()[0]
+	for _, queueEnv := range env.Queues {
+		if e.SQS.GetQueue(queueEnv.Name) == nil {
+			e.SQS.AddQueue(sqs.NewQueue(queueEnv.Name, queueHost))
+		}
+	}
+	for _, topic := range env.Topics {
+		newTopic := sns.NewTopic(nil, &topic.Name)
+		if e.SNS.GetTopic(newTopic.Arn) != nil {
+			continue
+		}
+		for _, subs := range topic.Subscriptions {
+			queue := e.SQS.GetQueue(subs.QueueName)
+			if queue == nil {
+				queue = sqs.NewQueue(subs.QueueName, queueHost)
+				e.SQS.AddQueue(queue)
+			}
+			subscription := sns.NewSubscription(newTopic.Arn, "sqs", queue.URL, subs.Raw)
+			if subs.FilterPolicy != "" {
+				if err := subscription.SetAttribute("FilterPolicy", subs.FilterPolicy); err != nil {
+					return err
+				}
+			}
+			if subs.FilterPolicyScope != "" {
+				if err := subscription.SetAttribute("FilterPolicyScope", subs.FilterPolicyScope); err != nil {
+					return err
+				}
+			}
+			newTopic.Subscriptions.Put(subscription)
+		}
+		e.SNS.AddTopic(newTopic)
+	}
+	return nil
+}
+
+// SetStore selects the store queues, messages and topics are persisted in and restores what it holds.
+// A nil store keeps them in memory only
+func (e *Emulator) SetStore(store storage.Store) error {
+	e.lock.Lock()
+	previous := e.store
+	e.store = store
+	e.lock.Unlock()
+	if previous != nil && previous != store {
+		if err := previous.Close(); err != nil {
+			log.Errorf("Failed to close storage: %v", err)
+		}
+	}
+	if err := e.SQS.SetStore(store); err != nil {
+		return err
+	}
+	return e.SNS.SetStore(store)
+}
+
+// Start runs the background work of the emulator, the retention sweeper
+func (e *Emulator) Start() {
+	e.SQS.StartRetentionSweeper(sqs.RetentionSweepInterval)
+}
+
+// Close stops the background work and closes the storage
+func (e *Emulator) Close() error {
+	e.SQS.Close()
+	e.SNS.Close()
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.store == nil {
+		return nil
+	}
+	return e.store.Close()
+}
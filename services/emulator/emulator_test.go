@@ -0,0 +1,72 @@
+package emulator
+
+import (
+	"testing"
+
+	"github.com/Tweddle-SE-Team/goaws/config"
+	"github.com/Tweddle-SE-Team/goaws/services/sns"
+	"github.com/Tweddle-SE-Team/goaws/services/sqs"
+)
+
+func TestNew_Isolated(t *testing.T) {
+	first := New()
+	second := New()
+	defer first.Close()
+	defer second.Close()
+
+	first.SQS.AddQueue(sqs.NewQueue("isolated-queue", "localhost:4100"))
+	if second.SQS.GetQueue("isolated-queue") != nil {
+		t.Errorf("expected emulators not to share queues")
+	}
+	first.Auth.SetCredentials(map[string]string{"AKIDLOCAL": "secret"})
+	if second.Auth.Enabled() {
+		t.Errorf("expected emulators not to share credentials")
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	env := &config.Environment{
+		Host:        "localhost",
+		Port:        "4200",
+		Queues:      []config.EnvQueue{{Name: "config-queue"}},
+		Topics:      []config.EnvTopic{{Name: "config-topic", Subscriptions: []config.EnvSubsciption{{QueueName: "subscriber-queue", Raw: true, FilterPolicy: `{"event": ["refund"]}`}}}},
+		Credentials: []config.EnvCredential{{AccessKeyId: "AKIDLOCAL", SecretAccessKey: "secret"}},
+	}
+	e, err := NewFromConfig(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	if queue := e.SQS.GetQueue("config-queue"); queue == nil || queue.URL != "http://localhost:4200/queue/config-queue" {
+		t.Errorf("expected config-queue to be created, got %+v", queue)
+	}
+	if e.SQS.GetQueue("subscriber-queue") == nil {
+		t.Errorf("expected the queue of the subscription to be created")
+	}
+	topic := e.SNS.GetTopic("arn:aws:sns:local:000000000000:config-topic")
+	if topic == nil || topic.Subscriptions.Size() != 1 {
+		t.Fatalf("expected config-topic with 1 subscription")
+	}
+	if subscription := topic.Subscriptions.Pop().(*sns.Subscription); subscription.FilterPolicy != `{"event": ["refund"]}` {
+		t.Errorf("expected the filter policy to be applied, got %+v", subscription)
+	}
+	if !e.Auth.Enabled() {
+		t.Errorf("expected the credentials to be applied")
+	}
+}
+
+func TestNewFromConfig_InvalidFilterPolicy(t *testing.T) {
+	env := &config.Environment{
+		Topics: []config.EnvTopic{{Name: "config-topic", Subscriptions: []config.EnvSubsciption{{QueueName: "subscriber-queue", FilterPolicy: `{"event": "refund"}`}}}},
+	}
+	if _, err := NewFromConfig(env); err == nil {
+		t.Errorf("expected an error for an invalid filter policy")
+	}
+}
+
+func TestNewFromConfig_UnknownStorage(t *testing.T) {
+	if _, err := NewFromConfig(&config.Environment{Storage: "redis"}); err == nil {
+		t.Errorf("expected an error for an unknown storage")
+	}
+}
@@ -1,14 +1,15 @@
 package router
 
 import (
-	"io"
 	"net/http"
 
 	"encoding/json"
 	"encoding/xml"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/Tweddle-SE-Team/goaws/services/auth"
 	"github.com/Tweddle-SE-Team/goaws/services/common"
+	"github.com/Tweddle-SE-Team/goaws/services/emulator"
 	"github.com/Tweddle-SE-Team/goaws/services/sns"
 	"github.com/Tweddle-SE-Team/goaws/services/sqs"
 	"github.com/gorilla/mux"
@@ -16,43 +17,81 @@ import (
 
 type AWSHandler func(request *http.Request) (interface{}, string, error)
 
-// New returns a new router
-func New() http.Handler {
+// New returns a router serving the SQS and SNS APIs of the emulator
+func New(e *emulator.Emulator) http.Handler {
 	r := mux.NewRouter()
+	actions := actionHandler(sqsRoutingTable(e.SQS), snsRoutingTable(e.SNS))
 
-	r.HandleFunc("/", actionHandler).Methods("GET", "POST")
-	r.HandleFunc("/queue/{queueName}", actionHandler).Methods("GET", "POST")
+	r.HandleFunc("/", withRequestId(withSignature(e.Auth, actions))).Methods("GET", "POST")
+	r.HandleFunc("/queue/{queueName}", withRequestId(withSignature(e.Auth, actions))).Methods("GET", "POST")
+	r.HandleFunc("/admin/sqs/queues", withRequestId(withSignature(e.Auth, adminHandler(e.SQS.QueueStatistics)))).Methods("GET")
+	r.HandleFunc("/admin/sns/deliveries", withRequestId(withSignature(e.Auth, adminHandler(e.SNS.DeliveryStatus)))).Methods("GET")
+	r.HandleFunc("/admin/snapshot", withRequestId(withSignature(e.Auth, adminHandler(e.ExportSnapshot)))).Methods("GET")
+	r.HandleFunc("/admin/snapshot", withRequestId(withSignature(e.Auth, adminHandler(e.ImportSnapshot)))).Methods("POST")
+	r.HandleFunc(sns.SigningCertPath, withRequestId(certificateHandler(e.SNS))).Methods("GET")
 
 	return r
 }
 
-var errorHandlers = []common.ErrorHandler{
-	sns.Errors,
-	sqs.Errors}
-
-func selectErrorHandler(err error) common.ErrorType {
-	errorMessage := err.Error()
-	errorType := common.ErrorType{}
-	for _, errorHandler := range errorHandlers {
-		for e, _ := range errorHandler {
-			if e == errorMessage {
-				return errorHandler[e]
-			}
-			errorType = errorHandler[e]
+// requestIdHeader carries the ID AWS assigns to every request
+const requestIdHeader = "x-amzn-RequestId"
+
+// withRequestId gives every call a unique request ID, sent in the x-amzn-RequestId header and the response body
+func withRequestId(next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		requestId, _ := common.NewUUID()
+		writer.Header().Set(requestIdHeader, requestId)
+		next(writer, common.WithRequestId(request, requestId))
+	}
+}
+
+// withSignature rejects requests which are not signed with one of the configured credentials.
+// Endpoints confirm subscriptions by visiting the unsigned SubscribeURL, and subscribers leave by visiting
+// the UnsubscribeURL of notifications, so these are let through.
+func withSignature(verifier *auth.Verifier, next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if isSubscriptionURL(request) {
+			next(writer, request)
+			return
+		}
+		if err := verifier.Verify(request); err != nil {
+			createErrorResponse(writer, request, err)
+			return
 		}
+		next(writer, request)
 	}
-	return errorType
+}
+
+// isSubscriptionURL reports whether the request is an unsigned GET of a ConfirmSubscription or Unsubscribe URL.
+// Only GET is let through: the form of other methods would take precedence over the query string.
+func isSubscriptionURL(request *http.Request) bool {
+	query := request.URL.Query()
+	action := query.Get("Action")
+	return request.Method == "GET" && (action == "ConfirmSubscription" || action == "Unsubscribe") &&
+		query.Get("X-Amz-Algorithm") == "" && request.Header.Get("Authorization") == ""
 }
 
 func createErrorResponse(writer http.ResponseWriter, request *http.Request, err error) {
-	e := selectErrorHandler(err)
+	e := common.ToErrorType(err)
+	if e == common.ErrInternalFailure {
+		log.Println("Internal failure:", err)
+	}
 	response := common.ErrorResponse{
-		common.ErrorResult{
-			Type:      e.Type,
-			Code:      e.Code,
-			Message:   e.Message,
-			RequestId: "00000000-0000-0000-0000-000000000000"}}
-
+		Result: common.ErrorResult{
+			Type:    e.Type,
+			Code:    e.Code,
+			Message: e.Message},
+		RequestId: common.RequestId(request)}
+
+	if isJSONRequest(request) {
+		writer.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		writer.Header().Set("x-amzn-query-error", e.Code+";"+e.Type)
+		writer.WriteHeader(e.HttpError)
+		if err := json.NewEncoder(writer).Encode(common.JSONErrorResponse{Type: sqs.JSONErrorType(e), Message: e.Message}); err != nil {
+			log.Printf("error: %v\n", err)
+		}
+		return
+	}
 	writer.WriteHeader(e.HttpError)
 	encoded := xml.NewEncoder(writer)
 	encoded.Indent("  ", "    ")
@@ -62,12 +101,17 @@ func createErrorResponse(writer http.ResponseWriter, request *http.Request, err
 }
 
 func sendResponse(writer http.ResponseWriter, request *http.Request, response interface{}, content string) {
-	if content == "JSON" {
+	if isJSONRequest(request) {
+		writer.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	} else if content == "JSON" {
 		writer.Header().Set("Content-Type", "application/json")
 	} else {
 		writer.Header().Set("Content-Type", "application/xml")
 	}
-	if content == "JSON" {
+	if jsonResponse, ok := response.(common.JSONResponse); ok && (content == "JSON" || isJSONRequest(request)) {
+		response = jsonResponse.JSONResult()
+	}
+	if content == "JSON" || isJSONRequest(request) {
 		encoded := json.NewEncoder(writer)
 		if err := encoded.Encode(response); err != nil {
 			log.Printf("error: %v\n", err)
@@ -81,12 +125,43 @@ func sendResponse(writer http.ResponseWriter, request *http.Request, response in
 	}
 }
 
-func response(writer http.ResponseWriter, request *http.Request) {
-	fn, ok := routingTable[request.FormValue("Action")]
+// isJSONRequest reports whether the request uses the AWS JSON protocol rather than the query protocol
+func isJSONRequest(request *http.Request) bool {
+	return request.Header.Get("X-Amz-Target") != ""
+}
+
+func jsonResponse(writer http.ResponseWriter, request *http.Request, sqsRoutes map[string]AWSHandler) {
+	action, ok := sqs.IsJSONAction(request.Header.Get("X-Amz-Target"))
+	fn, found := sqsRoutes[action]
+	if !ok || !found {
+		log.Println("Bad Request - Target:", request.Header.Get("X-Amz-Target"))
+		createErrorResponse(writer, request, common.ErrInvalidAction)
+		return
+	}
+	if err := sqs.DecodeJSONRequest(request, action); err != nil {
+		createErrorResponse(writer, request, err)
+		return
+	}
+	output, content, err := fn(request)
+	if err != nil {
+		createErrorResponse(writer, request, err)
+	} else {
+		sendResponse(writer, request, output, content)
+	}
+}
+
+func response(writer http.ResponseWriter, request *http.Request, sqsRoutes map[string]AWSHandler, snsRoutes map[string]AWSHandler) {
+	if isJSONRequest(request) {
+		jsonResponse(writer, request, sqsRoutes)
+		return
+	}
+	fn, ok := sqsRoutes[request.FormValue("Action")]
+	if !ok {
+		fn, ok = snsRoutes[request.FormValue("Action")]
+	}
 	if !ok {
 		log.Println("Bad Request - Action:", request.FormValue("Action"))
-		writer.WriteHeader(http.StatusBadRequest)
-		io.WriteString(writer, "Bad Request")
+		createErrorResponse(writer, request, common.ErrInvalidAction)
 		return
 	}
 	output, content, err := fn(request)
@@ -97,32 +172,69 @@ func response(writer http.ResponseWriter, request *http.Request) {
 	}
 }
 
-var routingTable = map[string]AWSHandler{
-	// SQS
-	"ListQueues":         sqs.Service.ListQueues,
-	"CreateQueue":        sqs.Service.CreateQueue,
-	"GetQueueAttributes": sqs.Service.GetQueueAttributes,
-	"SetQueueAttributes": sqs.Service.SetQueueAttributes,
-	"SendMessage":        sqs.Service.SendMessage,
-	"ReceiveMessage":     sqs.Service.ReceiveMessage,
-	"DeleteMessage":      sqs.Service.DeleteMessage,
-	"DeleteMessageBatch": sqs.Service.DeleteMessageBatch,
-	"GetQueueUrl":        sqs.Service.GetQueueUrl,
-	"PurgeQueue":         sqs.Service.PurgeQueue,
-	"DeleteQueue":        sqs.Service.DeleteQueue,
-
-	// SNS
-	"ListTopics":                sns.Service.ListTopics,
-	"CreateTopic":               sns.Service.CreateTopic,
-	"DeleteTopic":               sns.Service.DeleteTopic,
-	"Subscribe":                 sns.Service.Subscribe,
-	"SetSubscriptionAttributes": sns.Service.SetSubscriptionAttributes,
-	"ListSubscriptionsByTopic":  sns.Service.ListSubscriptionsByTopic,
-	"ListSubscriptions":         sns.Service.ListSubscriptions,
-	"Unsubscribe":               sns.Service.Unsubscribe,
-	"Publish":                   sns.Service.Publish,
+func sqsRoutingTable(service *sqs.SQS) map[string]AWSHandler {
+	return map[string]AWSHandler{
+		"ListQueues":                   service.ListQueues,
+		"CreateQueue":                  service.CreateQueue,
+		"GetQueueAttributes":           service.GetQueueAttributes,
+		"SetQueueAttributes":           service.SetQueueAttributes,
+		"SendMessage":                  service.SendMessage,
+		"SendMessageBatch":             service.SendMessageBatch,
+		"ReceiveMessage":               service.ReceiveMessage,
+		"DeleteMessage":                service.DeleteMessage,
+		"DeleteMessageBatch":           service.DeleteMessageBatch,
+		"GetQueueUrl":                  service.GetQueueUrl,
+		"PurgeQueue":                   service.PurgeQueue,
+		"DeleteQueue":                  service.DeleteQueue,
+		"ChangeMessageVisibility":      service.ChangeMessageVisibility,
+		"ChangeMessageVisibilityBatch": service.ChangeMessageVisibilityBatch,
+		"ListDeadLetterSourceQueues":   service.ListDeadLetterSourceQueues,
+	}
 }
 
-func actionHandler(writer http.ResponseWriter, request *http.Request) {
-	http.HandlerFunc(response).ServeHTTP(writer, request)
+func snsRoutingTable(service *sns.SNS) map[string]AWSHandler {
+	return map[string]AWSHandler{
+		"ListTopics":                service.ListTopics,
+		"CreateTopic":               service.CreateTopic,
+		"DeleteTopic":               service.DeleteTopic,
+		"Subscribe":                 service.Subscribe,
+		"ConfirmSubscription":       service.ConfirmSubscription,
+		"SetSubscriptionAttributes": service.SetSubscriptionAttributes,
+		"SetTopicAttributes":        service.SetTopicAttributes,
+		"ListSubscriptionsByTopic":  service.ListSubscriptionsByTopic,
+		"ListSubscriptions":         service.ListSubscriptions,
+		"Unsubscribe":               service.Unsubscribe,
+		"Publish":                   service.Publish,
+	}
+}
+
+func actionHandler(sqsRoutes map[string]AWSHandler, snsRoutes map[string]AWSHandler) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		response(writer, request, sqsRoutes, snsRoutes)
+	}
+}
+
+// certificateHandler serves the PEM certificate SNS messages are signed with, the SigningCertURL of notifications
+func certificateHandler(service *sns.SNS) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		certificate, err := service.SigningCertificate()
+		if err != nil {
+			createErrorResponse(writer, request, err)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/x-pem-file")
+		writer.Write(certificate)
+	}
+}
+
+// adminHandler serves an emulator endpoint which is not dispatched on the Action parameter
+func adminHandler(fn AWSHandler) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		output, content, err := fn(request)
+		if err != nil {
+			createErrorResponse(writer, request, err)
+		} else {
+			sendResponse(writer, request, output, content)
+		}
+	}
 }
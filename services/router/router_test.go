@@ -1,10 +1,18 @@
 package router
 
 import (
+	"encoding/json"
+	"encoding/xml"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/Tweddle-SE-Team/goaws/services/emulator"
+	"github.com/Tweddle-SE-Team/goaws/services/sns"
+	"github.com/Tweddle-SE-Team/goaws/services/sqs"
 )
 
 func TestIndexServerhandler_POST_BadRequest(t *testing.T) {
@@ -24,7 +32,7 @@ func TestIndexServerhandler_POST_BadRequest(t *testing.T) {
 
 	// Our handlers satisfy http.Handler, so we can call their ServeHTTP method
 	// directly and pass in our Request and ResponseRecorder.
-	New().ServeHTTP(rr, req)
+	New(emulator.New()).ServeHTTP(rr, req)
 
 	// Check the status code is what we expect.
 	if status := rr.Code; status != http.StatusBadRequest {
@@ -50,7 +58,7 @@ func TestIndexServerhandler_POST_GoodRequest(t *testing.T) {
 
 	// Our handlers satisfy http.Handler, so we can call their ServeHTTP method
 	// directly and pass in our Request and ResponseRecorder.
-	New().ServeHTTP(rr, req)
+	New(emulator.New()).ServeHTTP(rr, req)
 
 	// Check the status code is what we expect.
 	if status := rr.Code; status != http.StatusOK {
@@ -58,3 +66,319 @@ func TestIndexServerhandler_POST_GoodRequest(t *testing.T) {
 			status, http.StatusOK)
 	}
 }
+
+func newJSONRequest(t *testing.T, target string, body string) *http.Request {
+	req, err := http.NewRequest("POST", "/", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", target)
+	return req
+}
+
+func TestIndexServerhandler_JSON_SQS(t *testing.T) {
+	router := New(emulator.New())
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, newJSONRequest(t, "AmazonSQS.CreateQueue", `{"QueueName":"json-queue","Attributes":{"VisibilityTimeout":"45"}}`))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("CreateQueue returned %v: %s", rr.Code, rr.Body.String())
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/x-amz-json-1.0" {
+		t.Errorf("unexpected content type %s", contentType)
+	}
+	var created struct{ QueueUrl string }
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil || !strings.HasSuffix(created.QueueUrl, "/queue/json-queue") {
+		t.Fatalf("unexpected CreateQueue response %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, newJSONRequest(t, "AmazonSQS.SendMessage", `{"QueueUrl":"`+created.QueueUrl+`","MessageBody":"hello","MessageAttributes":{"trace":{"DataType":"String","StringValue":"abc"}}}`))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"MD5OfMessageBody":"5d41402abc4b2a76b9719d911017c592"`) {
+		t.Fatalf("unexpected SendMessage response %v: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, newJSONRequest(t, "AmazonSQS.ReceiveMessage", `{"QueueUrl":"`+created.QueueUrl+`","MaxNumberOfMessages":1,"MessageAttributeNames":["All"]}`))
+	var received struct {
+		Messages []struct {
+			Body              string
+			ReceiptHandle     string
+			MessageAttributes map[string]struct{ DataType, StringValue string }
+		}
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &received); err != nil || len(received.Messages) != 1 {
+		t.Fatalf("unexpected ReceiveMessage response %s", rr.Body.String())
+	}
+	if received.Messages[0].Body != "hello" || received.Messages[0].MessageAttributes["trace"].StringValue != "abc" {
+		t.Errorf("unexpected message %+v", received.Messages[0])
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, newJSONRequest(t, "AmazonSQS.GetQueueAttributes", `{"QueueUrl":"`+created.QueueUrl+`","AttributeNames":["VisibilityTimeout"]}`))
+	if body := strings.TrimSpace(rr.Body.String()); body != `{"Attributes":{"VisibilityTimeout":"45"}}` {
+		t.Errorf("unexpected GetQueueAttributes response %s", body)
+	}
+}
+
+func TestIndexServerhandler_JSON_Errors(t *testing.T) {
+	router := New(emulator.New())
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, newJSONRequest(t, "AmazonSQS.GetQueueUrl", `{"QueueName":"json-missing-queue"}`))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	var response struct {
+		Type    string `json:"__type"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil || response.Type != "com.amazonaws.sqs#QueueDoesNotExist" || response.Message == "" {
+		t.Errorf("unexpected error response %s", rr.Body.String())
+	}
+	if header := rr.Header().Get("x-amzn-query-error"); header != "AWS.SimpleQueueService.NonExistentQueue;Sender" {
+		t.Errorf("unexpected x-amzn-query-error %s", header)
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, newJSONRequest(t, "AmazonSQS.ListQueues", `{"QueueNamePrefix":`))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), `"__type":"com.amazon.coral.service#SerializationException"`) {
+		t.Errorf("unexpected response to a malformed body %v: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, newJSONRequest(t, "AmazonSQS.ListTopics", `{}`))
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), `"__type":"com.amazonaws.sqs#InvalidAction"`) {
+		t.Errorf("unexpected response to an SNS action %v: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestIndexServerhandler_RequestId(t *testing.T) {
+	router := New(emulator.New())
+	requestIds := make(map[string]bool)
+	for _, action := range []string{"ListQueues", "ListQueues", "ListTopics"} {
+		req, err := http.NewRequest("POST", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		form := url.Values{}
+		form.Add("Action", action)
+		req.PostForm = form
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		requestId := rr.Header().Get("x-amzn-RequestId")
+		if requestId == "" || requestId == "00000000-0000-0000-0000-000000000000" || requestIds[requestId] {
+			t.Fatalf("expected a unique request id, got %q", requestId)
+		}
+		requestIds[requestId] = true
+		if !strings.Contains(rr.Body.String(), "<RequestId>"+requestId+"</RequestId>") {
+			t.Errorf("request id %s missing from body %s", requestId, rr.Body.String())
+		}
+	}
+}
+
+func TestIndexServerhandler_POST_ErrorResponse(t *testing.T) {
+	req, err := http.NewRequest("POST", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := url.Values{}
+	form.Add("Action", "GetQueueUrl")
+	form.Add("QueueName", "missing-queue")
+	req.PostForm = form
+
+	rr := httptest.NewRecorder()
+	New(emulator.New()).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+	var response struct {
+		Error struct {
+			Type    string
+			Code    string
+			Message string
+		}
+		RequestId string
+	}
+	if err := xml.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Error.Type != "Sender" || response.Error.Code != "AWS.SimpleQueueService.NonExistentQueue" {
+		t.Errorf("unexpected error %+v", response.Error)
+	}
+	if response.RequestId != rr.Header().Get("x-amzn-RequestId") {
+		t.Errorf("body request id %s does not match header %s", response.RequestId, rr.Header().Get("x-amzn-RequestId"))
+	}
+}
+
+func TestIndexServerhandler_POST_InvalidTopicName(t *testing.T) {
+	req, err := http.NewRequest("POST", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := url.Values{}
+	form.Add("Action", "CreateTopic")
+	form.Add("Name", "invalid topic name")
+	req.PostForm = form
+
+	rr := httptest.NewRecorder()
+	New(emulator.New()).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "<Code>InvalidParameter</Code>") {
+		t.Errorf("unexpected response %v: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestIndexServerhandler_SignatureRequired(t *testing.T) {
+	e := emulator.New()
+	e.Auth.SetCredentials(map[string]string{"AKIDLOCAL": "secret"})
+
+	req, err := http.NewRequest("POST", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := url.Values{}
+	form.Add("Action", "ListQueues")
+	req.PostForm = form
+
+	rr := httptest.NewRecorder()
+	New(e).ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "<Code>MissingAuthenticationToken</Code>") {
+		t.Errorf("unexpected response to an unsigned request %v: %s", rr.Code, rr.Body.String())
+	}
+
+	req.Header.Set("X-Amz-Date", time.Now().UTC().Format("20060102T150405Z"))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential=AKIDOTHER/20150830/us-east-1/sqs/aws4_request, SignedHeaders=host;x-amz-date, Signature=0000")
+	rr = httptest.NewRecorder()
+	New(e).ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "<Code>InvalidClientTokenId</Code>") {
+		t.Errorf("unexpected response to an unknown access key %v: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAdminSnapshot(t *testing.T) {
+	router := New(emulator.New())
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/admin/snapshot", nil)
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 exporting a snapshot, got %d", rr.Code)
+	}
+	var snapshot struct {
+		Version int
+	}
+	body := rr.Body.String()
+	if err := json.Unmarshal([]byte(body), &snapshot); err != nil || snapshot.Version != 1 {
+		t.Fatalf("expected a version 1 snapshot, got %s", body)
+	}
+
+	// Importing the snapshot just exported leaves the state as it is
+	rr = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/admin/snapshot", strings.NewReader(body))
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 importing a snapshot, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/admin/snapshot", strings.NewReader(`{"Version": 99}`))
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "InvalidSnapshot") {
+		t.Errorf("expected InvalidSnapshot, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAdminSnapshot_SignatureRequired(t *testing.T) {
+	e := emulator.New()
+	e.Auth.SetCredentials(map[string]string{"AKIDLOCAL": "secret"})
+	e.SQS.AddQueue(sqs.NewQueue("kept", "localhost:4100"))
+	router := New(e)
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/admin/snapshot", strings.NewReader(`{"Version": 1}`))
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "MissingAuthenticationToken") {
+		t.Errorf("expected an unsigned import to be rejected, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if e.SQS.GetQueue("kept") == nil {
+		t.Error("expected the rejected import to leave the queues alone")
+	}
+
+	for _, path := range []string{"/admin/snapshot", "/admin/sqs/queues", "/admin/sns/deliveries"} {
+		rr = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", path, nil)
+		router.ServeHTTP(rr, req)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected an unsigned GET of %s to be rejected, got %d", path, rr.Code)
+		}
+	}
+}
+
+func TestSubscribeURL_Unsigned(t *testing.T) {
+	e := emulator.New()
+	e.Auth.SetCredentials(map[string]string{"AKIDLOCAL": "secret"})
+	name := "webhook-topic"
+	topic := sns.NewTopic(nil, &name)
+	subscription := sns.NewSubscription(topic.Arn, "http", "http://localhost:8080/", false)
+	subscription.PendingConfirmation = true
+	subscription.Token = "token"
+	topic.Subscriptions.Put(subscription)
+	e.SNS.AddTopic(topic)
+
+	query := url.Values{}
+	query.Set("Action", "ConfirmSubscription")
+	query.Set("TopicArn", topic.Arn)
+	query.Set("Token", "token")
+	req, _ := http.NewRequest("POST", "/?"+query.Encode(), nil)
+	rr := httptest.NewRecorder()
+	New(e).ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected an unsigned POST to be rejected, got %v", rr.Code)
+	}
+
+	req, _ = http.NewRequest("GET", "/?"+query.Encode(), nil)
+	rr = httptest.NewRecorder()
+	New(e).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), subscription.SubscriptionArn) {
+		t.Errorf("unexpected response to the SubscribeURL %v: %s", rr.Code, rr.Body.String())
+	}
+	if _, confirmed := e.SNS.GetSubscription(subscription.SubscriptionArn); confirmed == nil || confirmed.PendingConfirmation {
+		t.Errorf("expected the subscription to be confirmed")
+	}
+}
+
+func TestUnsubscribeURL_Unsigned(t *testing.T) {
+	e := emulator.New()
+	e.Auth.SetCredentials(map[string]string{"AKIDLOCAL": "secret"})
+	name := "leaving-topic"
+	topic := sns.NewTopic(nil, &name)
+	subscription := sns.NewSubscription(topic.Arn, "sqs", "arn:aws:sqs:us-east-1:000000000000:leaving", false)
+	topic.Subscriptions.Put(subscription)
+	e.SNS.AddTopic(topic)
+
+	query := url.Values{}
+	query.Set("Action", "Unsubscribe")
+	query.Set("SubscriptionArn", subscription.SubscriptionArn)
+	req, _ := http.NewRequest("GET", "/?"+query.Encode(), nil)
+	rr := httptest.NewRecorder()
+	New(e).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("unexpected response to the UnsubscribeURL %v: %s", rr.Code, rr.Body.String())
+	}
+	if _, subscribed := e.SNS.GetSubscription(subscription.SubscriptionArn); subscribed != nil {
+		t.Errorf("expected the subscription to be deleted")
+	}
+}
+
+func TestSigningCertificate(t *testing.T) {
+	req, _ := http.NewRequest("GET", sns.SigningCertPath, nil)
+	rr := httptest.NewRecorder()
+	New(emulator.New()).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Body.String(), "-----BEGIN CERTIFICATE-----") {
+		t.Errorf("unexpected certificate response %v: %s", rr.Code, rr.Body.String())
+	}
+}
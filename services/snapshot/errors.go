@@ -0,0 +1,14 @@
+package snapshot
+
+import (
+	"github.com/Tweddle-SE-Team/goaws/services/common"
+	"net/http"
+)
+
+var (
+	ErrInvalidSnapshot = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "InvalidSnapshot",
+		Message:   "The snapshot could not be read."}
+)
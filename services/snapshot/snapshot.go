@@ -0,0 +1,83 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Tweddle-SE-Team/goaws/services/sns"
+	"github.com/Tweddle-SE-Team/goaws/services/sqs"
+)
+
+// Version of the snapshot format, snapshots of another version are rejected
+const Version = 1
+
+// Snapshot is the whole state of the emulator: queues with their messages and topics with their subscriptions
+type Snapshot struct {
+	Version   int
+	CreatedAt time.Time
+	Queues    []sqs.QueueSnapshot
+	Topics    []sns.TopicRecord
+}
+
+// Take captures the state of the services
+func Take(sqsService *sqs.SQS, snsService *sns.SNS) *Snapshot {
+	return &Snapshot{
+		Version:   Version,
+		CreatedAt: time.Now().UTC(),
+		Queues:    sqsService.Snapshot(),
+		Topics:    snsService.Snapshot()}
+}
+
+// Restore replaces the state of the services with the snapshot. Messages keep their receive counts,
+// in-flight messages whose visibility deadline has passed since the snapshot was taken are visible again.
+func (s *Snapshot) Restore(sqsService *sqs.SQS, snsService *sns.SNS) {
+	sqsService.Restore(s.Queues)
+	snsService.Restore(s.Topics)
+}
+
+// Read decodes a snapshot and checks its version
+func Read(reader io.Reader) (*Snapshot, error) {
+	var s Snapshot
+	if err := json.NewDecoder(reader).Decode(&s); err != nil {
+		return nil, err
+	}
+	if s.Version != Version {
+		return nil, fmt.Errorf("unsupported snapshot version %d, expected %d", s.Version, Version)
+	}
+	return &s, nil
+}
+
+func ReadFile(path string) (*Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Read(file)
+}
+
+// WriteFile writes the snapshot to a temporary file first so an existing snapshot is never left half written
+func (s *Snapshot) WriteFile(path string) error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(append(content, '\n'))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,87 @@
+package snapshot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tweddle-SE-Team/goaws/services/sns"
+	"github.com/Tweddle-SE-Team/goaws/services/sqs"
+)
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	sqsService := sqs.NewSQS()
+	queue := sqs.NewQueue("snapshot-queue", "localhost:4100")
+	sqsService.AddQueue(queue)
+	attributes := []sqs.SqsMessageAttribute{{Name: "color", Value: sqs.SqsMessageAttributeValue{DataType: "String", StringValue: "blue"}}}
+	queue.SendMessage(sqs.NewMessage([]byte("received"), nil, "", ""))
+	queue.SendMessage(sqs.NewMessage([]byte("visible"), attributes, "", "md5"))
+	received := queue.ReceiveMessages(1, time.Minute, nil)
+	if len(received) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(received))
+	}
+	snsService := sns.NewSNS(sqsService)
+	name := "snapshot-topic"
+	topic := sns.NewTopic(nil, &name)
+	topic.Subscriptions.Put(sns.NewSubscription(topic.Arn, "sqs", queue.URL, true))
+	snsService.AddTopic(topic)
+
+	dir, err := ioutil.TempDir("", "goaws-snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.json")
+	if err := Take(sqsService, snsService).WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+	queue.Purge()
+
+	s, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restoredSQS := sqs.NewSQS()
+	restoredSQS.AddQueue(sqs.NewQueue("stale-queue", "localhost:4100"))
+	restoredSNS := sns.NewSNS(restoredSQS)
+	s.Restore(restoredSQS, restoredSNS)
+
+	if restoredSQS.GetQueue("stale-queue") != nil {
+		t.Errorf("expected queues missing from the snapshot to be removed")
+	}
+	restoredQueue := restoredSQS.GetQueue("snapshot-queue")
+	if restoredQueue == nil {
+		t.Fatal("expected the queue to be restored")
+	}
+	defer restoredQueue.Purge()
+	visible := restoredQueue.Messages.Pop().(*sqs.Message)
+	if string(visible.MessageBody) != "visible" || len(visible.MessageAttributes) != 1 || visible.MessageAttributes[0].Value.StringValue != "blue" {
+		t.Errorf("expected the visible message with its attributes, got %+v", visible)
+	}
+	inFlight := restoredQueue.InFlight[received[0].ReceiptHandle]
+	if inFlight == nil {
+		t.Fatal("expected the received message to still be in flight")
+	}
+	if inFlight.ApproximateReceiveCount != 1 || !inFlight.VisibilityDeadline.Equal(received[0].VisibilityDeadline) {
+		t.Errorf("expected receive count 1 and deadline %v, got %d and %v", received[0].VisibilityDeadline, inFlight.ApproximateReceiveCount, inFlight.VisibilityDeadline)
+	}
+	restoredTopic := restoredSNS.GetTopic(topic.Arn)
+	if restoredTopic == nil || restoredTopic.Subscriptions.Size() != 1 {
+		t.Fatal("expected the topic and its subscription to be restored")
+	}
+	if subscription := restoredTopic.Subscriptions.Pop().(*sns.Subscription); !subscription.Raw || subscription.EndPoint != queue.URL {
+		t.Errorf("unexpected subscription %+v", subscription)
+	}
+}
+
+func TestRead_Version(t *testing.T) {
+	if _, err := Read(strings.NewReader(`{"Version": 2}`)); err == nil {
+		t.Errorf("expected an error for an unsupported version")
+	}
+	if _, err := Read(strings.NewReader(`{"Version": 1, "Queues": []}`)); err != nil {
+		t.Errorf("expected version 1 to be read, got %v", err)
+	}
+}
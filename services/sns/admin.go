@@ -0,0 +1,16 @@
+package sns
+
+import (
+	"net/http"
+)
+
+// Admin endpoints are not part of the SNS API, they expose emulator internals as JSON
+
+type DeliveryStatusResponse struct {
+	Deliveries []Delivery
+}
+
+// DeliveryStatus lists the latest deliveries to http and https subscriptions with their outcome
+func (c *SNS) DeliveryStatus(request *http.Request) (interface{}, string, error) {
+	return &DeliveryStatusResponse{Deliveries: c.Deliveries()}, "JSON", nil
+}
@@ -1,59 +1,53 @@
 package sns
 
 import (
-	"encoding/json"
-	"errors"
 	"fmt"
-	log "github.com/sirupsen/logrus"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/Tweddle-SE-Team/goaws/services/common"
 	"github.com/Tweddle-SE-Team/goaws/services/sqs"
+	log "github.com/sirupsen/logrus"
 )
 
 func (c *SNS) CreateTopic(request *http.Request) (interface{}, string, error) {
 	topicName := request.FormValue("Name")
-	topicEquals := func(s interface{}, v interface{}) bool {
-		src := s.(*Topic)
-		value := v.(*string)
-		return src.Name == *value
+	if err := common.ValidateTopicName(topicName); err != nil {
+		return nil, "XML", ErrInvalidParameter.WithMessage("Invalid parameter: Topic Name")
 	}
-	topic := c.Topics.Get(&topicName, topicEquals)
+	topic := c.GetTopicByName(topicName)
 	if topic == nil {
 		topic = NewTopic(nil, &topicName)
-		c.Topics.Put(topic)
+		c.AddTopic(topic)
 	}
-	return NewCreateTopicResponse(CreateTopicResult{TopicArn: topic.(Topic).Arn}), "XML", nil
+	return NewCreateTopicResponse(common.RequestId(request), CreateTopicResult{TopicArn: topic.Arn}), "XML", nil
 }
 
 func (c *SNS) DeleteTopic(request *http.Request) (interface{}, string, error) {
 	topicArn := request.FormValue("TopicArn")
-	topicEquals := func(s interface{}, v interface{}) bool {
-		src := s.(*Topic)
-		value := v.(*string)
-		return src.Name == *value
-	}
-	if c.Topics.Remove(&topicArn, topicEquals) {
-		return NewDeleteTopicResponse(), "XML", nil
+	if c.RemoveTopic(topicArn) {
+		return NewDeleteTopicResponse(common.RequestId(request)), "XML", nil
 	} else {
-		return nil, "XML", errors.New("TopicNotFound")
+		return nil, "XML", ErrTopicNotFound
 	}
 }
 
 func (c *SNS) ListSubscriptions(request *http.Request) (interface{}, string, error) {
 	totalMemberResults := make([]TopicMemberResult, 0, 0)
-	for topic := range c.Topics.Iterator() {
-		for subscription := range topic.(*Topic).Subscriptions.Iterator() {
+	for t := range c.Topics.Iterator() {
+		topic := t.(*Topic)
+		for s := range topic.Subscriptions.Iterator() {
+			subscription := s.(*Subscription)
 			topicMemberResult := TopicMemberResult{
-				TopicArn:        topic.(*Topic).Arn,
-				Protocol:        subscription.(Subscription).Protocol,
-				SubscriptionArn: subscription.(Subscription).SubscriptionArn,
-				Endpoint:        subscription.(Subscription).EndPoint}
+				TopicArn:        topic.Arn,
+				Protocol:        subscription.Protocol,
+				SubscriptionArn: subscription.DisplayArn(),
+				Endpoint:        subscription.EndPoint}
 			totalMemberResults = append(totalMemberResults, topicMemberResult)
 		}
 	}
-	return NewListSubscriptionsResponse(
+	return NewListSubscriptionsResponse(common.RequestId(request),
 		ListSubscriptionsResult{
 			Subscriptions: TopicSubscriptions{
 				Member: totalMemberResults}}), "XML", nil
@@ -61,28 +55,24 @@ func (c *SNS) ListSubscriptions(request *http.Request) (interface{}, string, err
 
 func (c *SNS) ListSubscriptionsByTopic(request *http.Request) (interface{}, string, error) {
 	topicArn := request.FormValue("TopicArn")
-	topicEquals := func(s interface{}, v interface{}) bool {
-		src := s.(*Topic)
-		value := v.(*string)
-		return src.Arn == *value
-	}
-	topic := c.Topics.Get(&topicArn, topicEquals)
+	topic := c.GetTopic(topicArn)
 	if topic != nil {
 		topicMemberResults := make([]TopicMemberResult, 0, 0)
-		for subscription := range topic.(*Topic).Subscriptions.Iterator() {
+		for s := range topic.Subscriptions.Iterator() {
+			subscription := s.(*Subscription)
 			topicMemberResult := TopicMemberResult{
-				TopicArn:        topic.(*Topic).Arn,
-				Protocol:        subscription.(Subscription).Protocol,
-				SubscriptionArn: subscription.(Subscription).SubscriptionArn,
-				Endpoint:        subscription.(Subscription).EndPoint}
+				TopicArn:        topic.Arn,
+				Protocol:        subscription.Protocol,
+				SubscriptionArn: subscription.DisplayArn(),
+				Endpoint:        subscription.EndPoint}
 			topicMemberResults = append(topicMemberResults, topicMemberResult)
 		}
-		return NewListSubscriptionsByTopicResponse(
+		return NewListSubscriptionsByTopicResponse(common.RequestId(request),
 			ListSubscriptionsResult{
 				Subscriptions: TopicSubscriptions{
 					Member: topicMemberResults}}), "XML", nil
 	} else {
-		return nil, "XML", errors.New("TopicNotFound")
+		return nil, "XML", ErrTopicNotFound
 	}
 }
 
@@ -92,7 +82,7 @@ func (c *SNS) ListTopics(request *http.Request) (interface{}, string, error) {
 		topicArn := TopicArnResult{TopicArn: topic.(*Topic).Arn}
 		topicArnResult = append(topicArnResult, topicArn)
 	}
-	return NewListTopicsResponse(
+	return NewListTopicsResponse(common.RequestId(request),
 		ListTopicsResult{
 			Topics: TopicNamestype{
 				Member: topicArnResult}}), "XML", nil
@@ -100,137 +90,255 @@ func (c *SNS) ListTopics(request *http.Request) (interface{}, string, error) {
 
 func (c *SNS) Publish(request *http.Request) (interface{}, string, error) {
 	topicArn := request.FormValue("TopicArn")
-	topicEquals := func(s interface{}, v interface{}) bool {
-		src := s.(*Topic)
-		value := v.(*string)
-		return src.Arn == *value
+	if topicArn == "" {
+		return nil, "XML", ErrInvalidParameter.WithMessage("Invalid parameter: TopicArn or TargetArn Reason: no value for required parameter")
+	}
+	message := request.FormValue("Message")
+	if message == "" {
+		return nil, "XML", ErrInvalidParameter.WithMessage("Invalid parameter: Empty message")
+	}
+	if err := common.ValidateMessageBody(message); err != nil {
+		return nil, "XML", ErrInvalidParameter.WithMessage("Invalid parameter: Message Reason: " + err.Error())
+	}
+	if err := ValidateSubject(request.FormValue("Subject")); err != nil {
+		return nil, "XML", err
+	}
+	if MessageStructure(request.FormValue("MessageStructure")) == MessageStructureJson {
+		if _, err := common.ExtractMessageBodyFromJson(message, string(ProtocolDefault)); err != nil {
+			return nil, "XML", ErrInvalidParameter.WithMessage("Invalid parameter: Message Structure - " + err.Error())
+		}
+	}
+	messageAttributes, err := ExtractSnsMessageAttributes(request)
+	if err != nil {
+		return nil, "XML", err
+	}
+	size := len(message)
+	for _, attribute := range messageAttributes {
+		size += len(attribute.Name) + len(attribute.Type) + len(attribute.Value)
+	}
+	if size > common.MaxMessageSize {
+		return nil, "XML", ErrInvalidParameter.WithMessage("Invalid parameter: Message too long")
 	}
 	topicMessage := NewTopicMessage(
 		"Notification",
-		request.FormValue("TopicArn"),
-		request.FormValue("Message"),
-		ExtractSnsMessageAttributes(request),
+		topicArn,
+		message,
+		messageAttributes,
 		request.FormValue("MessageStructure"),
 		request.FormValue("Subject"))
-	queueEquals := func(s interface{}, v interface{}) bool {
-		src := s.(*sqs.Queue)
-		value := v.(*string)
-		return src.Name == *value
-	}
-	if topic := c.Topics.Get(&topicArn, topicEquals); topic != nil {
-		for s := range topic.(*Topic).Subscriptions.Iterator() {
+	topicMessage.base = baseURL(request)
+	if topic := c.GetTopic(topicArn); topic != nil {
+		for s := range topic.Subscriptions.Iterator() {
 			subscription := s.(*Subscription)
-			if Protocol(subscription.Protocol) == ProtocolSQS {
-				messageString, err := topicMessage.toString()
+			if !subscription.Accepts(topicMessage) {
+				continue
+			}
+			switch Protocol(subscription.Protocol) {
+			case ProtocolSQS:
+				sqsMessage, err := c.queueMessage(subscription, topicMessage)
 				if err == nil {
-					sqsMessage := sqs.NewMessage(messageString, make([]sqs.SqsMessageAttribute, 0, 0), "", "")
-					sqsMessage.UpdateReceiptHandle()
-					queueName := subscription.getQueueName()
-					q := sqs.Service.Queues.Get(&queueName, queueEquals)
-					if q != nil {
-						queue := q.(*sqs.Queue)
-						queue.Messages.Put(sqsMessage)
+					if queue := c.SQS.FindQueue(subscription.EndPoint); queue != nil {
+						if _, err := queue.SendMessage(sqsMessage); err != nil {
+							log.Errorf("Failed to deliver message to queue %s: %v", queue.Name, err)
+						}
 					}
 				} else {
 					return nil, "XML", err
 				}
+			case ProtocolHTTP, ProtocolHTTPS:
+				if !subscription.PendingConfirmation {
+					c.deliverHTTP(subscription, topicMessage)
+				}
+			default:
+				log.Debugf("Messages are not delivered to %s subscriptions", subscription.Protocol)
 			}
 		}
 	} else {
-		return nil, "XML", errors.New("TopicNotFound")
+		return nil, "XML", ErrTopicNotFound
 	}
-	messageId, _ := common.NewUUID()
-	return NewPublishResponse(PublishResult{MessageId: messageId}), "XML", nil
+	return NewPublishResponse(common.RequestId(request), PublishResult{MessageId: topicMessage.MessageId}), "XML", nil
 }
 
 func (c *SNS) SetSubscriptionAttributes(request *http.Request) (interface{}, string, error) {
 	subscriptionArn := request.FormValue("SubscriptionArn")
 	attribute := request.FormValue("AttributeName")
 	value := request.FormValue("AttributeValue")
-	subscriptionEquals := func(s interface{}, v interface{}) bool {
-		src := s.(*Subscription)
-		value := v.(*string)
-		return src.SubscriptionArn == *value
+	topic, subscription := c.GetSubscription(subscriptionArn)
+	if subscription == nil {
+		return nil, "XML", ErrSubscriptionNotFound
 	}
-	for t := range c.Topics.Iterator() {
-		topic := t.(*Topic)
-		s := topic.Subscriptions.Get(&subscriptionArn, subscriptionEquals)
-		if s != nil {
-			subscription := s.(*Subscription)
-			if attribute == "RawMessageDelivery" {
-				if value == "true" {
-					subscription.Raw = true
-				} else {
-					subscription.Raw = false
-				}
-				return NewSetSubscriptionAttributesResponse(), "XML", nil
+	err := c.updateSubscription(topic, subscription, func(subscription *Subscription) error {
+		return subscription.SetAttribute(attribute, value)
+	})
+	if err != nil {
+		return nil, "XML", err
+	}
+	return NewSetSubscriptionAttributesResponse(common.RequestId(request)), "XML", nil
+}
+
+func (c *SNS) SetTopicAttributes(request *http.Request) (interface{}, string, error) {
+	topic := c.GetTopic(request.FormValue("TopicArn"))
+	if topic == nil {
+		return nil, "XML", ErrTopicNotFound
+	}
+	value := request.FormValue("AttributeValue")
+	switch request.FormValue("AttributeName") {
+	case "DeliveryPolicy":
+		if value != "" {
+			if err := ValidateTopicDeliveryPolicy(value); err != nil {
+				return nil, "XML", ErrInvalidParameter.WithMessage("Invalid parameter: DeliveryPolicy: " + err.Error())
 			}
 		}
+		if !c.updateTopic(topic, func(topic *Topic) { topic.DeliveryPolicy = value }) {
+			return nil, "XML", ErrTopicNotFound
+		}
+	default:
+		return nil, "XML", ErrInvalidParameter.WithMessage("Invalid parameter: AttributeName")
 	}
-	return nil, "XML", errors.New("SubscriptionNotFound")
+	return NewSetTopicAttributesResponse(common.RequestId(request)), "XML", nil
 }
 
 func (c *SNS) Subscribe(request *http.Request) (interface{}, string, error) {
-	subscription := NewSubscription(
-		request.FormValue("TopicArn"),
-		request.FormValue("Protocol"),
-		request.FormValue("Endpoint"),
-		false)
-	topicEquals := func(s interface{}, v interface{}) bool {
-		src := s.(*Topic)
-		value := v.(*string)
-		return src.Name == *value
-	}
-	topicName := subscription.GetTopicName()
-	if t := c.Topics.Get(&topicName, topicEquals); t != nil {
-		topic := t.(*Topic)
+	if request.FormValue("TopicArn") == "" {
+		return nil, "XML", ErrInvalidParameter.WithMessage("Invalid parameter: TopicArn")
+	}
+	if !IsValidProtocol(request.FormValue("Protocol")) {
+		return nil, "XML", ErrInvalidParameter.WithMessage("Invalid parameter: Amazon SNS does not support this protocol string: " + request.FormValue("Protocol"))
+	}
+	if request.FormValue("Endpoint") == "" {
+		return nil, "XML", ErrInvalidParameter.WithMessage("Invalid parameter: Endpoint")
+	}
+	// Topics are matched by name, the region and account of the ARN are not checked
+	uriSegments := strings.Split(request.FormValue("TopicArn"), ":")
+	if topic := c.GetTopicByName(uriSegments[len(uriSegments)-1]); topic != nil {
+		subscription := NewSubscription(
+			topic.Arn,
+			request.FormValue("Protocol"),
+			request.FormValue("Endpoint"),
+			false)
+		for i := 1; request.FormValue(fmt.Sprintf("Attributes.entry.%d.key", i)) != ""; i++ {
+			name := request.FormValue(fmt.Sprintf("Attributes.entry.%d.key", i))
+			if err := subscription.SetAttribute(name, request.FormValue(fmt.Sprintf("Attributes.entry.%d.value", i))); err != nil {
+				return nil, "XML", err
+			}
+		}
+		if subscription.RequiresConfirmation() {
+			subscription.PendingConfirmation = true
+			subscription.Token = newToken()
+		}
 		topic.Subscriptions.Put(subscription)
-		return NewSubscribeResponse(SubscribeResult{
-			SubscriptionArn: subscription.SubscriptionArn}), "XML", nil
+		c.saveTopic(topic)
+		subscriptionArn := subscription.SubscriptionArn
+		if subscription.PendingConfirmation {
+			c.requestConfirmation(subscription, baseURL(request))
+			if request.FormValue("ReturnSubscriptionArn") != "true" {
+				subscriptionArn = "pending confirmation"
+			}
+		}
+		return NewSubscribeResponse(common.RequestId(request), SubscribeResult{
+			SubscriptionArn: subscriptionArn}), "XML", nil
 	} else {
-		return nil, "XML", errors.New("TopicNotFound")
+		return nil, "XML", ErrTopicNotFound
 	}
 }
 
-func (c *SNS) Unsubscribe(request *http.Request) (interface{}, string, error) {
-	subscriptionArn := request.FormValue("SubscriptionArn")
-	subscriptionEquals := func(src interface{}, value interface{}) bool {
-		return src.(Subscription).SubscriptionArn == value.(string)
+// ConfirmSubscription confirms a pending subscription with the token sent to its endpoint.
+// It is also called by visiting the SubscribeURL, so it is served to unsigned requests.
+func (c *SNS) ConfirmSubscription(request *http.Request) (interface{}, string, error) {
+	topicArn := request.FormValue("TopicArn")
+	token := request.FormValue("Token")
+	if topicArn == "" {
+		return nil, "XML", ErrInvalidParameter.WithMessage("Invalid parameter: TopicArn")
 	}
-	for topic := range c.Topics.Iterator() {
-		if topic.(*Topic).Subscriptions.Remove(&subscriptionArn, subscriptionEquals) {
-			return NewUnsubscribeResponse(), "XML", nil
+	if token == "" {
+		return nil, "XML", ErrInvalidParameter.WithMessage("Invalid parameter: Token")
+	}
+	topic := c.GetTopic(topicArn)
+	if topic == nil {
+		return nil, "XML", ErrTopicNotFound
+	}
+	var subscription *Subscription
+	topic.Subscriptions.Scan(func(s interface{}) bool {
+		if s.(*Subscription).Token == token {
+			subscription = s.(*Subscription)
+		}
+		return subscription == nil
+	})
+	if subscription == nil {
+		return nil, "XML", ErrInvalidParameter.WithMessage("Invalid token")
+	}
+	if subscription.PendingConfirmation {
+		err := c.updateSubscription(topic, subscription, func(subscription *Subscription) error {
+			subscription.PendingConfirmation = false
+			return nil
+		})
+		if err != nil {
+			return nil, "XML", err
 		}
 	}
-	return nil, "XML", errors.New("SubscriptionNotFound")
+	return NewConfirmSubscriptionResponse(common.RequestId(request), ConfirmSubscriptionResult{
+		SubscriptionArn: subscription.SubscriptionArn}), "XML", nil
 }
 
-func ExtractSnsMessageAttributes(req *http.Request) []SnsMessageAttribute {
+func (c *SNS) Unsubscribe(request *http.Request) (interface{}, string, error) {
+	subscriptionArn := request.FormValue("SubscriptionArn")
+	topic, subscription := c.GetSubscription(subscriptionArn)
+	if subscription == nil || topic.Subscriptions.RemoveKey(subscriptionArn) == nil {
+		return nil, "XML", ErrSubscriptionNotFound
+	}
+	c.saveTopic(topic)
+	return NewUnsubscribeResponse(common.RequestId(request)), "XML", nil
+}
+
+func ExtractSnsMessageAttributes(req *http.Request) ([]SnsMessageAttribute, error) {
 	attributes := make([]SnsMessageAttribute, 0, 0)
+	names := make(map[string]bool)
 
 	for i := 1; true; i++ {
 		name := req.FormValue(fmt.Sprintf("MessageAttributes.entry.%d.Name", i))
 		if name == "" {
 			break
 		}
+		if i > common.MaxMessageAttributes {
+			return nil, ErrInvalidParameterValue.WithMessage(fmt.Sprintf("Number of message attributes exceeds the allowed maximum [%d].", common.MaxMessageAttributes))
+		}
+		if err := common.ValidateMessageAttributeName(name); err != nil {
+			return nil, ErrInvalidParameterValue.WithMessage(err.Error())
+		}
+		if names[name] {
+			return nil, ErrInvalidParameterValue.WithMessage(fmt.Sprintf("Message attribute name '%s' is not unique.", name))
+		}
+		names[name] = true
 		dataType := req.FormValue(fmt.Sprintf("MessageAttributes.entry.%d.Value.DataType", i))
 		if dataType == "" {
-			log.Warnf("DataType of MessageAttribute %s is missing, MD5 checksum will most probably be wrong!\n", name)
-			continue
+			return nil, ErrInvalidParameterValue.WithMessage(fmt.Sprintf("The message attribute '%s' must contain non-empty message attribute type.", name))
 		}
 		// StringListValue and BinaryListValue is currently not implemented
-		for _, valueKey := range [...]string{"StringValue", "BinaryValue"} {
-
-			value := req.FormValue(fmt.Sprintf("MessageAttributes.entry.%d.Value.%s", i, valueKey))
-			if value != "" {
-				attributes = append(attributes, SnsMessageAttribute{Name: name, Value: value, Type: dataType})
-				continue
-			}
+		valueKey := "StringValue"
+		if strings.HasPrefix(dataType, "Binary") {
+			valueKey = "BinaryValue"
+		}
+		value := req.FormValue(fmt.Sprintf("MessageAttributes.entry.%d.Value.%s", i, valueKey))
+		if err := common.ValidateMessageAttributeValue(name, dataType, value); err != nil {
+			return nil, ErrInvalidParameterValue.WithMessage(err.Error())
 		}
-		log.Warnf("StringValue or BinaryValue of MessageAttribute %s is missing, MD5 checksum will most probably be wrong!\n", name)
+		attributes = append(attributes, SnsMessageAttribute{Name: name, Value: value, Type: dataType})
 	}
 
-	return attributes
+	return attributes, nil
+}
+
+// ValidateSubject checks a Publish subject: up to 100 printable ASCII characters without line breaks
+func ValidateSubject(subject string) error {
+	if len(subject) > 100 {
+		return ErrInvalidParameter.WithMessage("Invalid parameter: Subject")
+	}
+	for _, r := range subject {
+		if r < 0x20 || r > 0x7E {
+			return ErrInvalidParameter.WithMessage("Invalid parameter: Subject")
+		}
+	}
+	return nil
 }
 
 /*** List Topics Response */
@@ -252,11 +360,10 @@ type ListTopicsResponse struct {
 	Metadata common.ResponseMetadata `xml:"ResponseMetadata"`
 }
 
-func NewListTopicsResponse(result ListTopicsResult) *ListTopicsResponse {
-	uuid, _ := common.NewUUID()
+func NewListTopicsResponse(requestId string, result ListTopicsResult) *ListTopicsResponse {
 	return &ListTopicsResponse{
 		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
-		Metadata: common.ResponseMetadata{RequestId: uuid},
+		Metadata: common.ResponseMetadata{RequestId: requestId},
 		Result:   result}
 }
 
@@ -271,11 +378,10 @@ type CreateTopicResponse struct {
 	Metadata common.ResponseMetadata `xml:"ResponseMetadata"`
 }
 
-func NewCreateTopicResponse(result CreateTopicResult) *CreateTopicResponse {
-	uuid, _ := common.NewUUID()
+func NewCreateTopicResponse(requestId string, result CreateTopicResult) *CreateTopicResponse {
 	return &CreateTopicResponse{
 		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
-		Metadata: common.ResponseMetadata{RequestId: uuid},
+		Metadata: common.ResponseMetadata{RequestId: requestId},
 		Result:   result}
 }
 
@@ -290,14 +396,44 @@ type SubscribeResponse struct {
 	Metadata common.ResponseMetadata `xml:"ResponseMetadata"`
 }
 
-func NewSubscribeResponse(result SubscribeResult) *SubscribeResponse {
-	uuid, _ := common.NewUUID()
+func NewSubscribeResponse(requestId string, result SubscribeResult) *SubscribeResponse {
 	return &SubscribeResponse{
 		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
-		Metadata: common.ResponseMetadata{RequestId: uuid},
+		Metadata: common.ResponseMetadata{RequestId: requestId},
+		Result:   result}
+}
+
+/*** Confirm Subscription ***/
+type ConfirmSubscriptionResult struct {
+	SubscriptionArn string `xml:"SubscriptionArn"`
+}
+
+type ConfirmSubscriptionResponse struct {
+	Xmlns    string                    `xml:"xmlns,attr"`
+	Result   ConfirmSubscriptionResult `xml:"ConfirmSubscriptionResult"`
+	Metadata common.ResponseMetadata   `xml:"ResponseMetadata"`
+}
+
+func NewConfirmSubscriptionResponse(requestId string, result ConfirmSubscriptionResult) *ConfirmSubscriptionResponse {
+	return &ConfirmSubscriptionResponse{
+		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
+		Metadata: common.ResponseMetadata{RequestId: requestId},
 		Result:   result}
 }
 
+/*** Set Topic Attributes ***/
+
+type SetTopicAttributesResponse struct {
+	Xmlns    string                  `xml:"xmlns,attr"`
+	Metadata common.ResponseMetadata `xml:"ResponseMetadata"`
+}
+
+func NewSetTopicAttributesResponse(requestId string) *SetTopicAttributesResponse {
+	return &SetTopicAttributesResponse{
+		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
+		Metadata: common.ResponseMetadata{RequestId: requestId}}
+}
+
 /***  Set Subscription Response ***/
 
 type SetSubscriptionAttributesResponse struct {
@@ -305,11 +441,10 @@ type SetSubscriptionAttributesResponse struct {
 	Metadata common.ResponseMetadata `xml:"ResponseMetadata"`
 }
 
-func NewSetSubscriptionAttributesResponse() *SetSubscriptionAttributesResponse {
-	uuid, _ := common.NewUUID()
+func NewSetSubscriptionAttributesResponse(requestId string) *SetSubscriptionAttributesResponse {
 	return &SetSubscriptionAttributesResponse{
 		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
-		Metadata: common.ResponseMetadata{RequestId: uuid}}
+		Metadata: common.ResponseMetadata{RequestId: requestId}}
 }
 
 /*** List Subscriptions Response */
@@ -335,11 +470,10 @@ type ListSubscriptionsResponse struct {
 	Metadata common.ResponseMetadata `xml:"ResponseMetadata"`
 }
 
-func NewListSubscriptionsResponse(result ListSubscriptionsResult) *ListSubscriptionsResponse {
-	uuid, _ := common.NewUUID()
+func NewListSubscriptionsResponse(requestId string, result ListSubscriptionsResult) *ListSubscriptionsResponse {
 	return &ListSubscriptionsResponse{
 		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
-		Metadata: common.ResponseMetadata{RequestId: uuid},
+		Metadata: common.ResponseMetadata{RequestId: requestId},
 		Result:   result}
 }
 
@@ -355,50 +489,125 @@ type ListSubscriptionsByTopicResponse struct {
 	Metadata common.ResponseMetadata `xml:"ResponseMetadata"`
 }
 
-func NewListSubscriptionsByTopicResponse(result ListSubscriptionsResult) *ListSubscriptionsByTopicResponse {
-	uuid, _ := common.NewUUID()
+func NewListSubscriptionsByTopicResponse(requestId string, result ListSubscriptionsResult) *ListSubscriptionsByTopicResponse {
 	return &ListSubscriptionsByTopicResponse{
 		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
-		Metadata: common.ResponseMetadata{RequestId: uuid},
+		Metadata: common.ResponseMetadata{RequestId: requestId},
 		Result:   result}
 }
 
+// TopicMessage is a message of a topic, subscriptions receive it in the notification envelope AWS sends,
+// with the fields in the same order
 type TopicMessage struct {
-	Type              string                `json:"Type,omitempty"`
-	MessageId         string                `json:"MessageId,omitempty"`
-	TopicArn          string                `json:"TopicArn,omitempty"`
-	Subject           string                `json:"Subject,omitempty"`
-	Message           string                `json:"Message,omitempty"`
-	TimeStamp         string                `json:"TimeStamp,omitempty"`
-	MessageAttributes []SnsMessageAttribute `json:"MessageAttributes,omitempty"`
-	MessageStructure  string                `json:"MessageStructure,omitempty"`
+	Type              string                           `json:"Type"`
+	MessageId         string                           `json:"MessageId"`
+	Token             string                           `json:"Token,omitempty"`
+	TopicArn          string                           `json:"TopicArn"`
+	Subject           string                           `json:"Subject,omitempty"`
+	Message           string                           `json:"Message"`
+	SubscribeURL      string                           `json:"SubscribeURL,omitempty"`
+	Timestamp         string                           `json:"Timestamp"`
+	SignatureVersion  string                           `json:"SignatureVersion"`
+	Signature         string                           `json:"Signature"`
+	SigningCertURL    string                           `json:"SigningCertURL"`
+	UnsubscribeURL    string                           `json:"UnsubscribeURL,omitempty"`
+	MessageAttributes map[string]TopicMessageAttribute `json:"MessageAttributes,omitempty"`
+	MessageStructure  string                           `json:"-"`
+
+	attributes []SnsMessageAttribute
+	// base is the URL of the emulator the links of the envelope point to
+	base string
+}
+
+// TopicMessageAttribute is a message attribute as notifications list it
+type TopicMessageAttribute struct {
+	Type  string
+	Value string
 }
 
 func NewTopicMessage(Type string, TopicArn string, Message string, MessageAttributes []SnsMessageAttribute, MessageStructure string, Subject string) *TopicMessage {
 	MessageId, _ := common.NewUUID()
-	TimeStamp := fmt.Sprintln(time.Now().Format("2006-01-02T15:04:05:001Z"))
+	Timestamp := time.Now().UTC().Format(TimestampFormat)
+	var attributes map[string]TopicMessageAttribute
+	if len(MessageAttributes) > 0 {
+		attributes = make(map[string]TopicMessageAttribute, len(MessageAttributes))
+		for _, attribute := range MessageAttributes {
+			attributes[attribute.Name] = TopicMessageAttribute{Type: attribute.Type, Value: attribute.Value}
+		}
+	}
 	return &TopicMessage{
 		Type:              Type,
 		TopicArn:          TopicArn,
 		Message:           Message,
-		MessageAttributes: MessageAttributes,
+		MessageAttributes: attributes,
 		MessageId:         MessageId,
-		TimeStamp:         TimeStamp,
+		Timestamp:         Timestamp,
 		MessageStructure:  MessageStructure,
-		Subject:           Subject}
+		Subject:           Subject,
+		attributes:        MessageAttributes}
 }
 
-func (c *TopicMessage) toString() ([]byte, error) {
-	if MessageStructure(c.MessageStructure) == MessageStructureJson {
-		message, err := common.ExtractMessageBodyFromJson(c.Message, "sqs")
-		if err != nil {
-			messageArray := *message
-			return []byte(messageArray), nil
+// isRaw reports whether a subscription receives the message without the notification envelope
+func (c *TopicMessage) isRaw(subscription *Subscription) bool {
+	return subscription.Raw && c.Type == "Notification"
+}
+
+// bodyFor is what a subscription receives: the message alone if it is raw, the notification envelope otherwise
+func (c *SNS) bodyFor(subscription *Subscription, message *TopicMessage) ([]byte, error) {
+	if !message.isRaw(subscription) {
+		return c.envelope(subscription, message)
+	}
+	body, err := message.messageFor(subscription.Protocol)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(body), nil
+}
+
+// sqsAttributes converts the attributes of a message to SQS ones and returns them with their MD5
+func (c *SNS) sqsAttributes(message *TopicMessage) ([]sqs.SqsMessageAttribute, string) {
+	attributes := make([]sqs.SqsMessageAttribute, 0, len(message.attributes))
+	if len(message.attributes) == 0 {
+		return attributes, ""
+	}
+	hashed := make(map[string]sqs.SqsMessageAttribute, len(message.attributes))
+	for _, attribute := range message.attributes {
+		value := sqs.SqsMessageAttributeValue{DataType: attribute.Type}
+		if strings.HasPrefix(attribute.Type, "Binary") {
+			value.BinaryValue = attribute.Value
+		} else {
+			value.StringValue = attribute.Value
 		}
-		c.Message = *message
+		converted := sqs.SqsMessageAttribute{Name: attribute.Name, Value: value}
+		attributes = append(attributes, converted)
+		hashed[attribute.Name] = converted
+	}
+	return attributes, c.SQS.HashAttributes(hashed)
+}
+
+// queueMessage is the SQS message a subscription receives, raw subscriptions get the message attributes as SQS ones
+func (c *SNS) queueMessage(subscription *Subscription, message *TopicMessage) (*sqs.Message, error) {
+	body, err := c.bodyFor(subscription, message)
+	if err != nil {
+		return nil, err
+	}
+	if !message.isRaw(subscription) {
+		return sqs.NewMessage(body, make([]sqs.SqsMessageAttribute, 0, 0), "", ""), nil
+	}
+	attributes, md5 := c.sqsAttributes(message)
+	return sqs.NewMessage(body, attributes, "", md5), nil
+}
+
+// messageFor is the message sent to a subscription of the protocol, which selects the body of a json MessageStructure
+func (c *TopicMessage) messageFor(protocol string) (string, error) {
+	if MessageStructure(c.MessageStructure) != MessageStructureJson {
+		return c.Message, nil
+	}
+	message, err := common.ExtractMessageBodyFromJson(c.Message, protocol)
+	if err != nil {
+		return "", err
 	}
-	byteMsg, _ := json.Marshal(c)
-	return byteMsg, nil
+	return *message, nil
 }
 
 /*** Publish ***/
@@ -413,11 +622,10 @@ type PublishResponse struct {
 	Metadata common.ResponseMetadata `xml:"ResponseMetadata"`
 }
 
-func NewPublishResponse(result PublishResult) *PublishResponse {
-	uuid, _ := common.NewUUID()
+func NewPublishResponse(requestId string, result PublishResult) *PublishResponse {
 	return &PublishResponse{
 		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
-		Metadata: common.ResponseMetadata{RequestId: uuid},
+		Metadata: common.ResponseMetadata{RequestId: requestId},
 		Result:   result}
 }
 
@@ -427,11 +635,10 @@ type UnsubscribeResponse struct {
 	Metadata common.ResponseMetadata `xml:"ResponseMetadata"`
 }
 
-func NewUnsubscribeResponse() *UnsubscribeResponse {
-	uuid, _ := common.NewUUID()
+func NewUnsubscribeResponse(requestId string) *UnsubscribeResponse {
 	return &UnsubscribeResponse{
 		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
-		Metadata: common.ResponseMetadata{RequestId: uuid}}
+		Metadata: common.ResponseMetadata{RequestId: requestId}}
 }
 
 /*** Delete Topic ***/
@@ -440,11 +647,10 @@ type DeleteTopicResponse struct {
 	Metadata common.ResponseMetadata `xml:"ResponseMetadata"`
 }
 
-func NewDeleteTopicResponse() *DeleteTopicResponse {
-	uuid, _ := common.NewUUID()
+func NewDeleteTopicResponse(requestId string) *DeleteTopicResponse {
 	return &DeleteTopicResponse{
 		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
-		Metadata: common.ResponseMetadata{RequestId: uuid}}
+		Metadata: common.ResponseMetadata{RequestId: requestId}}
 }
 
 /*** Get Message Attributes ***/
@@ -0,0 +1,279 @@
+package sns
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Tweddle-SE-Team/goaws/services/sqs"
+)
+
+func newFormRequest(t *testing.T, form url.Values) *http.Request {
+	req, err := http.NewRequest("POST", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.PostForm = form
+	return req
+}
+
+func TestSubscriptions(t *testing.T) {
+	service := NewSNS(sqs.NewSQS())
+	queue := sqs.NewQueue("subscriber", "localhost:4100")
+	service.SQS.AddQueue(queue)
+	name := "subscribed-topic"
+	topic := NewTopic(nil, &name)
+	service.AddTopic(topic)
+
+	form := url.Values{}
+	form.Set("TopicArn", topic.Arn)
+	form.Set("Protocol", "sqs")
+	form.Set("Endpoint", queue.Arn)
+	output, _, err := service.Subscribe(newFormRequest(t, form))
+	if err != nil {
+		t.Fatalf("Subscribe returned error: %v", err)
+	}
+	subscriptionArn := output.(*SubscribeResponse).Result.SubscriptionArn
+
+	output, _, err = service.ListSubscriptions(newFormRequest(t, url.Values{}))
+	if err != nil {
+		t.Fatalf("ListSubscriptions returned error: %v", err)
+	}
+	members := output.(*ListSubscriptionsResponse).Result.Subscriptions.Member
+	if len(members) != 1 || members[0].SubscriptionArn != subscriptionArn || members[0].Endpoint != queue.Arn {
+		t.Errorf("unexpected subscriptions %+v", members)
+	}
+
+	form = url.Values{}
+	form.Set("TopicArn", topic.Arn)
+	form.Set("Message", "hello")
+	if _, _, err := service.Publish(newFormRequest(t, form)); err != nil {
+		t.Fatalf("Publish returned error: %v", err)
+	}
+	if size := queue.Messages.Size(); size != 1 {
+		t.Errorf("expected the message to be delivered to the queue ARN, got %d messages", size)
+	} else if handle := queue.Peek()[0].ReceiptHandle; handle != "" {
+		t.Errorf("expected no receipt handle before the message is received, got %s", handle)
+	}
+
+	form = url.Values{}
+	form.Set("SubscriptionArn", subscriptionArn)
+	form.Set("AttributeName", "RawMessageDelivery")
+	form.Set("AttributeValue", "true")
+	if _, _, err := service.SetSubscriptionAttributes(newFormRequest(t, form)); err != nil {
+		t.Fatalf("SetSubscriptionAttributes returned error: %v", err)
+	}
+	if _, subscription := service.GetSubscription(subscriptionArn); subscription == nil || !subscription.Raw {
+		t.Errorf("expected a raw subscription, got %+v", subscription)
+	}
+
+	form = url.Values{}
+	form.Set("SubscriptionArn", subscriptionArn)
+	if _, _, err := service.Unsubscribe(newFormRequest(t, form)); err != nil {
+		t.Fatalf("Unsubscribe returned error: %v", err)
+	}
+	if _, _, err := service.Unsubscribe(newFormRequest(t, form)); err != ErrSubscriptionNotFound {
+		t.Errorf("expected NotFound unsubscribing twice, got %v", err)
+	}
+	if topic.Subscriptions.Size() != 0 {
+		t.Errorf("expected no subscriptions left, got %d", topic.Subscriptions.Size())
+	}
+}
+
+type postedMessage struct {
+	header  http.Header
+	message map[string]string
+}
+
+func newEndpoint(t *testing.T) (*httptest.Server, chan postedMessage) {
+	posted := make(chan postedMessage, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		message := map[string]string{}
+		if err := json.NewDecoder(request.Body).Decode(&message); err != nil {
+			t.Errorf("could not decode posted message: %v", err)
+		}
+		posted <- postedMessage{header: request.Header, message: message}
+	}))
+	t.Cleanup(server.Close)
+	return server, posted
+}
+
+func nextPost(t *testing.T, posted chan postedMessage) postedMessage {
+	select {
+	case p := <-posted:
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing was posted to the endpoint")
+	}
+	return postedMessage{}
+}
+
+func TestSubscribe_HTTPConfirmation(t *testing.T) {
+	endpoint, posted := newEndpoint(t)
+	service := NewSNS(sqs.NewSQS())
+	name := "webhook-topic"
+	topic := NewTopic(nil, &name)
+	service.AddTopic(topic)
+
+	form := url.Values{}
+	form.Set("TopicArn", topic.Arn)
+	form.Set("Protocol", "http")
+	form.Set("Endpoint", endpoint.URL)
+	request := newFormRequest(t, form)
+	request.Host = "localhost:4100"
+	output, _, err := service.Subscribe(request)
+	if err != nil {
+		t.Fatalf("Subscribe returned error: %v", err)
+	}
+	if arn := output.(*SubscribeResponse).Result.SubscriptionArn; arn != "pending confirmation" {
+		t.Errorf("expected a pending subscription, got %s", arn)
+	}
+
+	confirmation := nextPost(t, posted)
+	if confirmation.header.Get("x-amz-sns-message-type") != "SubscriptionConfirmation" || confirmation.message["Type"] != "SubscriptionConfirmation" {
+		t.Fatalf("expected a SubscriptionConfirmation, got %v", confirmation.message)
+	}
+	subscribeURL, err := url.Parse(confirmation.message["SubscribeURL"])
+	if err != nil || subscribeURL.Host != "localhost:4100" || subscribeURL.Query().Get("Token") != confirmation.message["Token"] {
+		t.Fatalf("unexpected SubscribeURL %s", confirmation.message["SubscribeURL"])
+	}
+
+	output, _, _ = service.ListSubscriptionsByTopic(newFormRequest(t, url.Values{"TopicArn": {topic.Arn}}))
+	if members := output.(*ListSubscriptionsByTopicResponse).Result.Subscriptions.Member; len(members) != 1 || members[0].SubscriptionArn != "PendingConfirmation" {
+		t.Errorf("expected the subscription to be listed as pending, got %+v", members)
+	}
+	form = url.Values{}
+	form.Set("TopicArn", topic.Arn)
+	form.Set("Message", "before")
+	service.Publish(newFormRequest(t, form))
+
+	if _, _, err := service.ConfirmSubscription(newFormRequest(t, url.Values{"TopicArn": {topic.Arn}, "Token": {"wrong"}})); err == nil {
+		t.Error("expected a wrong token to be rejected")
+	}
+	output, _, err = service.ConfirmSubscription(newFormRequest(t, subscribeURL.Query()))
+	if err != nil {
+		t.Fatalf("ConfirmSubscription returned error: %v", err)
+	}
+	subscriptionArn := output.(*ConfirmSubscriptionResponse).Result.SubscriptionArn
+	if _, subscription := service.GetSubscription(subscriptionArn); subscription == nil || subscription.PendingConfirmation {
+		t.Fatalf("expected a confirmed subscription, got %+v", subscription)
+	}
+
+	form.Set("Message", "after")
+	form.Set("Subject", "greeting")
+	service.Publish(newFormRequest(t, form))
+	notification := nextPost(t, posted)
+	if notification.message["Message"] != "after" || notification.message["Subject"] != "greeting" {
+		t.Errorf("expected only the message published after confirmation, got %v", notification.message)
+	}
+	header := notification.header
+	if header.Get("x-amz-sns-message-type") != "Notification" || header.Get("x-amz-sns-topic-arn") != topic.Arn ||
+		header.Get("x-amz-sns-subscription-arn") != subscriptionArn || header.Get("x-amz-sns-message-id") != notification.message["MessageId"] {
+		t.Errorf("unexpected notification headers %v", header)
+	}
+}
+
+func TestPublish_RawMessageDelivery(t *testing.T) {
+	service := NewSNS(sqs.NewSQS())
+	name := "attributes-topic"
+	topic := NewTopic(nil, &name)
+	service.AddTopic(topic)
+	raw := sqs.NewQueue("raw", "localhost:4100")
+	wrapped := sqs.NewQueue("wrapped", "localhost:4100")
+	service.SQS.AddQueue(raw)
+	service.SQS.AddQueue(wrapped)
+	topic.Subscriptions.Put(NewSubscription(topic.Arn, "sqs", raw.Arn, true))
+	topic.Subscriptions.Put(NewSubscription(topic.Arn, "sqs", wrapped.Arn, false))
+
+	attributes := []SnsMessageAttribute{
+		{Name: "event", Type: "String", Value: "purchase"},
+		{Name: "price", Type: "Number", Value: "12.5"},
+		{Name: "payload", Type: "Binary", Value: "AQID"},
+	}
+	form := url.Values{}
+	form.Set("TopicArn", topic.Arn)
+	form.Set("Message", "hello")
+	sqsForm := url.Values{}
+	for i, attribute := range attributes {
+		prefix := "MessageAttributes.entry." + strconv.Itoa(i+1)
+		sqsPrefix := "MessageAttribute." + strconv.Itoa(i+1)
+		valueKey := ".Value.StringValue"
+		if attribute.Type == "Binary" {
+			valueKey = ".Value.BinaryValue"
+		}
+		form.Set(prefix+".Name", attribute.Name)
+		form.Set(prefix+".Value.DataType", attribute.Type)
+		form.Set(prefix+valueKey, attribute.Value)
+		sqsForm.Set(sqsPrefix+".Name", attribute.Name)
+		sqsForm.Set(sqsPrefix+".Value.DataType", attribute.Type)
+		sqsForm.Set(sqsPrefix+valueKey, attribute.Value)
+	}
+	if _, _, err := service.Publish(newFormRequest(t, form)); err != nil {
+		t.Fatalf("Publish returned error: %v", err)
+	}
+
+	message := raw.Messages.Pop().(*sqs.Message)
+	if string(message.MessageBody) != "hello" {
+		t.Errorf("expected the raw body, got %s", message.MessageBody)
+	}
+	// the MD5 must be the one SQS computes for the same attributes sent directly
+	_, expectedMD5, err := service.SQS.ExtractSqsMessageAttributes(newFormRequest(t, sqsForm), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(message.MessageAttributes) != 3 || message.MD5OfMessageAttributes != expectedMD5 {
+		t.Errorf("expected 3 attributes with MD5 %s, got %+v with %s", expectedMD5, message.MessageAttributes, message.MD5OfMessageAttributes)
+	}
+	for _, attribute := range message.MessageAttributes {
+		if attribute.Name == "payload" && (attribute.Value.BinaryValue != "AQID" || attribute.Value.StringValue != "") {
+			t.Errorf("expected a binary attribute, got %+v", attribute.Value)
+		}
+		if attribute.Name == "price" && (attribute.Value.StringValue != "12.5" || attribute.Value.DataType != "Number") {
+			t.Errorf("expected a number attribute, got %+v", attribute.Value)
+		}
+	}
+
+	message = wrapped.Messages.Pop().(*sqs.Message)
+	var envelope struct {
+		Message           string
+		MessageAttributes map[string]struct{ Type, Value string }
+	}
+	if err := json.Unmarshal(message.MessageBody, &envelope); err != nil {
+		t.Fatalf("expected a notification envelope, got %s", message.MessageBody)
+	}
+	if envelope.Message != "hello" || len(message.MessageAttributes) != 0 {
+		t.Errorf("expected the message inside the envelope only, got %s", message.MessageBody)
+	}
+	if attribute := envelope.MessageAttributes["price"]; len(envelope.MessageAttributes) != 3 || attribute.Type != "Number" || attribute.Value != "12.5" {
+		t.Errorf("expected the attributes as a map, got %+v", envelope.MessageAttributes)
+	}
+}
+
+func TestPublish_RawHTTPDelivery(t *testing.T) {
+	posted := make(chan *http.Request, 1)
+	bodies := make(chan string, 1)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+		posted <- request
+		bodies <- string(body)
+	}))
+	defer endpoint.Close()
+	service := NewSNS(sqs.NewSQS())
+	defer service.Close()
+	topic, _ := newHTTPSubscription(t, service, endpoint.URL, map[string]string{"RawMessageDelivery": "true"})
+
+	publish(t, service, topic.Arn, "hello")
+	select {
+	case request := <-posted:
+		if body := <-bodies; body != "hello" || request.Header.Get("x-amz-sns-rawdelivery") != "true" {
+			t.Errorf("expected a raw delivery, got %s with headers %v", body, request.Header)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing was posted to the endpoint")
+	}
+}
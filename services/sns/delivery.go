@@ -0,0 +1,366 @@
+package sns
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RetryPolicy is the healthyRetryPolicy of a DeliveryPolicy, delays are in seconds.
+// A failed delivery is retried numRetries times: first numNoDelayRetries times at once, then
+// numMinDelayRetries times after minDelayTarget, then with delays growing from minDelayTarget to
+// maxDelayTarget following backoffFunction, and finally numMaxDelayRetries times after maxDelayTarget.
+type RetryPolicy struct {
+	MinDelayTarget     int    `json:"minDelayTarget"`
+	MaxDelayTarget     int    `json:"maxDelayTarget"`
+	NumRetries         int    `json:"numRetries"`
+	NumNoDelayRetries  int    `json:"numNoDelayRetries"`
+	NumMinDelayRetries int    `json:"numMinDelayRetries"`
+	NumMaxDelayRetries int    `json:"numMaxDelayRetries"`
+	BackoffFunction    string `json:"backoffFunction"`
+}
+
+// DefaultRetryPolicy is the policy of http and https subscriptions AWS uses when none is set
+var DefaultRetryPolicy = RetryPolicy{
+	MinDelayTarget:  20,
+	MaxDelayTarget:  20,
+	NumRetries:      3,
+	BackoffFunction: "linear",
+}
+
+// RequestPolicy sets the Content-Type of the posted messages
+type RequestPolicy struct {
+	HeaderContentType string `json:"headerContentType"`
+}
+
+// SubscriptionRedrivePolicy sends messages which could not be delivered to an SQS dead-letter queue
+type SubscriptionRedrivePolicy struct {
+	DeadLetterTargetArn string `json:"deadLetterTargetArn"`
+}
+
+// parseRetryPolicy reads a retry policy, fields which are not set keep their default
+func parseRetryPolicy(raw json.RawMessage) (*RetryPolicy, error) {
+	policy := DefaultRetryPolicy
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, policy.validate()
+}
+
+func (p *RetryPolicy) validate() error {
+	switch {
+	case p.NumRetries < 0 || p.NumRetries > 100:
+		return fmt.Errorf("numRetries must be between 0 and 100")
+	case p.NumNoDelayRetries < 0 || p.NumMinDelayRetries < 0 || p.NumMaxDelayRetries < 0:
+		return fmt.Errorf("retry counts must not be negative")
+	case p.NumNoDelayRetries+p.NumMinDelayRetries+p.NumMaxDelayRetries > p.NumRetries:
+		return fmt.Errorf("numNoDelayRetries, numMinDelayRetries and numMaxDelayRetries must not exceed numRetries")
+	case p.MinDelayTarget < 0 || p.MaxDelayTarget < p.MinDelayTarget || p.MaxDelayTarget > 3600:
+		return fmt.Errorf("minDelayTarget must not exceed maxDelayTarget, which must not exceed 3600")
+	}
+	switch p.BackoffFunction {
+	case "linear", "arithmetic", "geometric", "exponential":
+		return nil
+	}
+	return fmt.Errorf("backoffFunction must be linear, arithmetic, geometric or exponential")
+}
+
+// Delays lists how long to wait before each retry, in seconds
+func (p *RetryPolicy) Delays() []float64 {
+	delays := make([]float64, 0, p.NumRetries)
+	for i := 0; i < p.NumNoDelayRetries; i++ {
+		delays = append(delays, 0)
+	}
+	for i := 0; i < p.NumMinDelayRetries; i++ {
+		delays = append(delays, float64(p.MinDelayTarget))
+	}
+	backoff := p.NumRetries - p.NumNoDelayRetries - p.NumMinDelayRetries - p.NumMaxDelayRetries
+	for i := 1; i <= backoff; i++ {
+		delays = append(delays, p.backoff(i, backoff))
+	}
+	for i := 0; i < p.NumMaxDelayRetries; i++ {
+		delays = append(delays, float64(p.MaxDelayTarget))
+	}
+	return delays
+}
+
+// backoff is the delay of the i-th of n retries of the backoff phase, the last one waits maxDelayTarget
+func (p *RetryPolicy) backoff(i int, n int) float64 {
+	min, max := float64(p.MinDelayTarget), float64(p.MaxDelayTarget)
+	x, total := float64(i), float64(n)
+	switch p.BackoffFunction {
+	case "arithmetic":
+		return min + (max-min)*x*(x+1)/(total*(total+1))
+	case "geometric":
+		if min > 0 {
+			return min * math.Pow(max/min, x/total)
+		}
+	case "exponential":
+		return min + (max-min)*(math.Pow(2, x)-1)/(math.Pow(2, total)-1)
+	}
+	return min + (max-min)*x/total
+}
+
+// ValidateDeliveryPolicy checks the DeliveryPolicy attribute of a subscription
+func ValidateDeliveryPolicy(value string) error {
+	_, _, err := subscriptionPolicies(value)
+	return err
+}
+
+// ValidateTopicDeliveryPolicy checks the DeliveryPolicy attribute of a topic
+func ValidateTopicDeliveryPolicy(value string) error {
+	var policy struct {
+		HTTP *struct {
+			DefaultHealthyRetryPolicy json.RawMessage `json:"defaultHealthyRetryPolicy"`
+		} `json:"http"`
+	}
+	if err := json.Unmarshal([]byte(value), &policy); err != nil {
+		return err
+	}
+	if policy.HTTP != nil && policy.HTTP.DefaultHealthyRetryPolicy != nil {
+		_, err := parseRetryPolicy(policy.HTTP.DefaultHealthyRetryPolicy)
+		return err
+	}
+	return nil
+}
+
+// subscriptionPolicies reads the retry and request policy of a subscription DeliveryPolicy
+func subscriptionPolicies(value string) (*RetryPolicy, *RequestPolicy, error) {
+	var policy struct {
+		HealthyRetryPolicy json.RawMessage `json:"healthyRetryPolicy"`
+		RequestPolicy      *RequestPolicy  `json:"requestPolicy"`
+	}
+	if err := json.Unmarshal([]byte(value), &policy); err != nil {
+		return nil, nil, err
+	}
+	var retryPolicy *RetryPolicy
+	if policy.HealthyRetryPolicy != nil {
+		var err error
+		if retryPolicy, err = parseRetryPolicy(policy.HealthyRetryPolicy); err != nil {
+			return nil, nil, err
+		}
+	}
+	return retryPolicy, policy.RequestPolicy, nil
+}
+
+// ParseSubscriptionRedrivePolicy reads the RedrivePolicy attribute of a subscription
+func ParseSubscriptionRedrivePolicy(value string) (*SubscriptionRedrivePolicy, error) {
+	var policy SubscriptionRedrivePolicy
+	if err := json.Unmarshal([]byte(value), &policy); err != nil {
+		return nil, err
+	}
+	if policy.DeadLetterTargetArn == "" {
+		return nil, fmt.Errorf("deadLetterTargetArn is missing")
+	}
+	return &policy, nil
+}
+
+// deliveryPolicy resolves the policies of a subscription: its own DeliveryPolicy, unless the topic
+// disables overrides, then the topic defaults, then the AWS defaults
+func deliveryPolicy(topic *Topic, subscription *Subscription) (RetryPolicy, string) {
+	retryPolicy, contentType := DefaultRetryPolicy, "text/plain; charset=UTF-8"
+	overrides := true
+	if topic != nil && topic.DeliveryPolicy != "" {
+		var policy struct {
+			HTTP *struct {
+				DefaultHealthyRetryPolicy    json.RawMessage `json:"defaultHealthyRetryPolicy"`
+				DefaultRequestPolicy         *RequestPolicy  `json:"defaultRequestPolicy"`
+				DisableSubscriptionOverrides bool            `json:"disableSubscriptionOverrides"`
+			} `json:"http"`
+		}
+		if json.Unmarshal([]byte(topic.DeliveryPolicy), &policy) == nil && policy.HTTP != nil {
+			if policy.HTTP.DefaultHealthyRetryPolicy != nil {
+				if p, err := parseRetryPolicy(policy.HTTP.DefaultHealthyRetryPolicy); err == nil {
+					retryPolicy = *p
+				}
+			}
+			if policy.HTTP.DefaultRequestPolicy != nil && policy.HTTP.DefaultRequestPolicy.HeaderContentType != "" {
+				contentType = policy.HTTP.DefaultRequestPolicy.HeaderContentType
+			}
+			overrides = !policy.HTTP.DisableSubscriptionOverrides
+		}
+	}
+	if overrides && subscription.DeliveryPolicy != "" {
+		if p, requestPolicy, err := subscriptionPolicies(subscription.DeliveryPolicy); err == nil {
+			if p != nil {
+				retryPolicy = *p
+			}
+			if requestPolicy != nil && requestPolicy.HeaderContentType != "" {
+				contentType = requestPolicy.HeaderContentType
+			}
+		}
+	}
+	return retryPolicy, contentType
+}
+
+// Delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+	DeliveryRedriven  = "redriven"
+	// DeliveryAbandoned is a delivery whose subscription was deleted before it succeeded
+	DeliveryAbandoned = "abandoned"
+)
+
+// MaxDeliveries is how many deliveries are kept for the admin endpoint, the oldest are dropped first
+const MaxDeliveries = 1000
+
+// Delivery is the outcome of posting a message to an http or https subscription
+type Delivery struct {
+	MessageId       string
+	Type            string
+	TopicArn        string
+	SubscriptionArn string
+	Endpoint        string
+	Status          string
+	Attempts        int
+	LastError       string `json:",omitempty"`
+	DeadLetterQueue string `json:",omitempty"`
+	Created         time.Time
+	LastAttempt     time.Time
+}
+
+// recordDelivery adds a delivery to the log, it is changed through updateDelivery
+func (c *SNS) recordDelivery(delivery Delivery) *Delivery {
+	c.deliveryLock.Lock()
+	defer c.deliveryLock.Unlock()
+	if len(c.deliveries) >= MaxDeliveries {
+		c.deliveries = c.deliveries[1:]
+	}
+	c.deliveries = append(c.deliveries, &delivery)
+	return &delivery
+}
+
+// updateDelivery changes a delivery of the log
+func (c *SNS) updateDelivery(delivery *Delivery, update func(*Delivery)) {
+	c.deliveryLock.Lock()
+	defer c.deliveryLock.Unlock()
+	update(delivery)
+}
+
+// Deliveries returns a copy of the delivery log, oldest first
+func (c *SNS) Deliveries() []Delivery {
+	c.deliveryLock.Lock()
+	defer c.deliveryLock.Unlock()
+	deliveries := make([]Delivery, 0, len(c.deliveries))
+	for _, delivery := range c.deliveries {
+		deliveries = append(deliveries, *delivery)
+	}
+	return deliveries
+}
+
+// deliverHTTP posts a message to an http or https subscription in the background, retrying as its
+// DeliveryPolicy says. Messages which could not be delivered go to the RedrivePolicy dead-letter queue.
+func (c *SNS) deliverHTTP(subscription *Subscription, message *TopicMessage) {
+	c.deliveryLock.Lock()
+	if c.closed {
+		c.deliveryLock.Unlock()
+		return
+	}
+	c.workers.Add(1)
+	c.deliveryLock.Unlock()
+
+	retryPolicy, contentType := deliveryPolicy(c.GetTopic(subscription.TopicArn), subscription)
+	delivery := c.recordDelivery(Delivery{
+		MessageId:       message.MessageId,
+		Type:            message.Type,
+		TopicArn:        subscription.TopicArn,
+		SubscriptionArn: subscription.SubscriptionArn,
+		Endpoint:        subscription.EndPoint,
+		Status:          DeliveryPending,
+		Created:         time.Now()})
+	go func() {
+		defer c.workers.Done()
+		delays := retryPolicy.Delays()
+		attempt := 0
+		for ; ; attempt++ {
+			err := c.post(subscription, message, contentType)
+			c.updateDelivery(delivery, func(delivery *Delivery) {
+				delivery.Attempts++
+				delivery.LastAttempt = time.Now()
+				if err == nil {
+					delivery.Status = DeliveryDelivered
+					delivery.LastError = ""
+				} else {
+					delivery.LastError = err.Error()
+				}
+			})
+			if err == nil {
+				return
+			}
+			log.Debugf("Delivery of message %s to %s failed: %v", message.MessageId, subscription.EndPoint, err)
+			if attempt >= len(delays) {
+				break
+			}
+			timer := time.NewTimer(time.Duration(delays[attempt] * float64(c.RetryDelayUnit)))
+			select {
+			case <-timer.C:
+			case <-c.done:
+				timer.Stop()
+				return
+			}
+			// Retries stop once the subscription is deleted
+			_, current := c.GetSubscription(subscription.SubscriptionArn)
+			if current == nil {
+				c.updateDelivery(delivery, func(delivery *Delivery) {
+					delivery.Status = DeliveryAbandoned
+				})
+				return
+			}
+			subscription = current
+		}
+		c.redrive(subscription, message, delivery, attempt+1)
+	}()
+}
+
+// redrive sends a message which could not be delivered to the dead-letter queue of the subscription
+func (c *SNS) redrive(subscription *Subscription, message *TopicMessage, delivery *Delivery, attempts int) {
+	status, deadLetterQueue := DeliveryFailed, ""
+	if subscription.RedrivePolicy != "" && message.Type == "Notification" {
+		policy, err := ParseSubscriptionRedrivePolicy(subscription.RedrivePolicy)
+		if err == nil {
+			err = c.sendToQueue(policy.DeadLetterTargetArn, subscription, message)
+		}
+		if err == nil {
+			status, deadLetterQueue = DeliveryRedriven, policy.DeadLetterTargetArn
+		} else {
+			log.Errorf("Failed to redrive message %s of subscription %s: %v", message.MessageId, subscription.SubscriptionArn, err)
+		}
+	}
+	if status == DeliveryFailed {
+		log.Errorf("Failed to deliver message %s to %s after %d attempts", message.MessageId, subscription.EndPoint, attempts)
+	}
+	c.updateDelivery(delivery, func(delivery *Delivery) {
+		delivery.Status = status
+		delivery.DeadLetterQueue = deadLetterQueue
+	})
+}
+
+// sendToQueue puts a message, as it would have been posted to the subscription, on an SQS queue
+func (c *SNS) sendToQueue(queueArn string, subscription *Subscription, message *TopicMessage) error {
+	queue := c.SQS.GetQueueByArn(queueArn)
+	if queue == nil {
+		return fmt.Errorf("queue %s does not exist", queueArn)
+	}
+	sqsMessage, err := c.queueMessage(subscription, message)
+	if err != nil {
+		return err
+	}
+	_, err = queue.SendMessage(sqsMessage)
+	return err
+}
+
+// Close stops retrying deliveries and waits for the posts in progress
+func (c *SNS) Close() {
+	c.deliveryLock.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.done)
+	}
+	c.deliveryLock.Unlock()
+	c.workers.Wait()
+}
@@ -0,0 +1,214 @@
+package sns
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Tweddle-SE-Team/goaws/services/sqs"
+)
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRetryPolicy_Delays(t *testing.T) {
+	if delays := DefaultRetryPolicy.Delays(); !reflect.DeepEqual(delays, []float64{20, 20, 20}) {
+		t.Errorf("unexpected default delays %v", delays)
+	}
+	policy := RetryPolicy{
+		MinDelayTarget:     2,
+		MaxDelayTarget:     8,
+		NumRetries:         6,
+		NumNoDelayRetries:  1,
+		NumMinDelayRetries: 1,
+		NumMaxDelayRetries: 1,
+		BackoffFunction:    "linear"}
+	if delays := policy.Delays(); !reflect.DeepEqual(delays, []float64{0, 2, 4, 6, 8, 8}) {
+		t.Errorf("unexpected linear delays %v", delays)
+	}
+	for _, backoffFunction := range []string{"arithmetic", "geometric", "exponential"} {
+		policy.BackoffFunction = backoffFunction
+		delays := policy.Delays()
+		if delays[2] <= 2 || delays[2] >= delays[3] || delays[4] != 8 {
+			t.Errorf("expected %s delays to grow to the maximum, got %v", backoffFunction, delays)
+		}
+	}
+}
+
+func TestDeliveryPolicy_Resolution(t *testing.T) {
+	topic := &Topic{DeliveryPolicy: `{"http":{"defaultHealthyRetryPolicy":{"numRetries":5,"minDelayTarget":1,"maxDelayTarget":1}}}`}
+	subscription := &Subscription{DeliveryPolicy: `{"healthyRetryPolicy":{"numRetries":1},"requestPolicy":{"headerContentType":"application/json"}}`}
+	if policy, contentType := deliveryPolicy(topic, subscription); policy.NumRetries != 1 || contentType != "application/json" {
+		t.Errorf("expected the subscription policy to apply, got %+v %s", policy, contentType)
+	}
+	topic.DeliveryPolicy = `{"http":{"defaultHealthyRetryPolicy":{"numRetries":5,"minDelayTarget":1,"maxDelayTarget":1},"disableSubscriptionOverrides":true}}`
+	if policy, contentType := deliveryPolicy(topic, subscription); policy.NumRetries != 5 || contentType != "text/plain; charset=UTF-8" {
+		t.Errorf("expected the topic policy to apply, got %+v %s", policy, contentType)
+	}
+
+	for _, invalid := range []string{`{`, `{"healthyRetryPolicy":{"numRetries":1,"numNoDelayRetries":2}}`, `{"healthyRetryPolicy":{"backoffFunction":"random"}}`} {
+		if err := subscription.SetAttribute("DeliveryPolicy", invalid); err == nil {
+			t.Errorf("expected DeliveryPolicy %s to be rejected", invalid)
+		}
+	}
+	if err := subscription.SetAttribute("RedrivePolicy", `{}`); err == nil {
+		t.Error("expected a RedrivePolicy without deadLetterTargetArn to be rejected")
+	}
+}
+
+func newHTTPSubscription(t *testing.T, service *SNS, endpoint string, attributes map[string]string) (*Topic, *Subscription) {
+	name := "delivery-topic"
+	topic := NewTopic(nil, &name)
+	service.AddTopic(topic)
+	subscription := NewSubscription(topic.Arn, "http", endpoint, false)
+	for name, value := range attributes {
+		if err := subscription.SetAttribute(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	topic.Subscriptions.Put(subscription)
+	return topic, subscription
+}
+
+func publish(t *testing.T, service *SNS, topicArn string, message string) {
+	form := url.Values{}
+	form.Set("TopicArn", topicArn)
+	form.Set("Message", message)
+	if _, _, err := service.Publish(newFormRequest(t, form)); err != nil {
+		t.Fatalf("Publish returned error: %v", err)
+	}
+}
+
+func TestDeliverHTTP_Retries(t *testing.T) {
+	var calls int32
+	endpoint := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			writer.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer endpoint.Close()
+	service := NewSNS(sqs.NewSQS())
+	defer service.Close()
+	topic, subscription := newHTTPSubscription(t, service, endpoint.URL, map[string]string{
+		"DeliveryPolicy": `{"healthyRetryPolicy":{"numRetries":3,"numNoDelayRetries":3}}`})
+
+	publish(t, service, topic.Arn, "hello")
+	waitFor(t, func() bool {
+		deliveries := service.Deliveries()
+		return len(deliveries) == 1 && deliveries[0].Status != DeliveryPending
+	})
+	delivery := service.Deliveries()[0]
+	if delivery.Status != DeliveryDelivered || delivery.Attempts != 3 || delivery.SubscriptionArn != subscription.SubscriptionArn {
+		t.Errorf("unexpected delivery %+v", delivery)
+	}
+}
+
+func TestDeliverHTTP_RedrivePolicy(t *testing.T) {
+	var calls int32
+	endpoint := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer endpoint.Close()
+	service := NewSNS(sqs.NewSQS())
+	service.RetryDelayUnit = time.Millisecond
+	defer service.Close()
+	deadLetterQueue := sqs.NewQueue("undeliverable", "localhost:4100")
+	service.SQS.AddQueue(deadLetterQueue)
+	topic, _ := newHTTPSubscription(t, service, endpoint.URL, map[string]string{
+		"DeliveryPolicy": `{"healthyRetryPolicy":{"numRetries":2,"minDelayTarget":1,"maxDelayTarget":5,"backoffFunction":"exponential"}}`,
+		"RedrivePolicy":  `{"deadLetterTargetArn":"` + deadLetterQueue.Arn + `"}`})
+
+	publish(t, service, topic.Arn, "hello")
+	waitFor(t, func() bool {
+		deliveries := service.Deliveries()
+		return len(deliveries) == 1 && deliveries[0].Status != DeliveryPending
+	})
+	delivery := service.Deliveries()[0]
+	if delivery.Status != DeliveryRedriven || delivery.Attempts != 3 || delivery.DeadLetterQueue != deadLetterQueue.Arn {
+		t.Errorf("unexpected delivery %+v", delivery)
+	}
+	if atomic.LoadInt32(&calls) != 3 || deadLetterQueue.Messages.Size() != 1 {
+		t.Errorf("expected 3 posts and the message in the dead-letter queue, got %d posts and %d messages", calls, deadLetterQueue.Messages.Size())
+	}
+}
+
+func TestClose_StopsRetries(t *testing.T) {
+	endpoint := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer endpoint.Close()
+	service := NewSNS(sqs.NewSQS())
+	topic, _ := newHTTPSubscription(t, service, endpoint.URL, nil)
+
+	publish(t, service, topic.Arn, "hello")
+	waitFor(t, func() bool {
+		deliveries := service.Deliveries()
+		return len(deliveries) == 1 && deliveries[0].Attempts == 1
+	})
+	done := make(chan struct{})
+	go func() {
+		service.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not stop the retries")
+	}
+	if delivery := service.Deliveries()[0]; delivery.Status != DeliveryPending {
+		t.Errorf("expected the delivery to stay pending, got %+v", delivery)
+	}
+}
+
+func TestDeliverHTTP_Unsubscribed(t *testing.T) {
+	var calls int32
+	endpoint := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		writer.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer endpoint.Close()
+	service := NewSNS(sqs.NewSQS())
+	service.RetryDelayUnit = 10 * time.Millisecond
+	defer service.Close()
+	topic, subscription := newHTTPSubscription(t, service, endpoint.URL, nil)
+
+	publish(t, service, topic.Arn, "hello")
+	waitFor(t, func() bool {
+		deliveries := service.Deliveries()
+		return len(deliveries) == 1 && deliveries[0].Attempts == 1
+	})
+	form := url.Values{}
+	form.Set("SubscriptionArn", subscription.SubscriptionArn)
+	if _, _, err := service.Unsubscribe(newFormRequest(t, form)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		return service.Deliveries()[0].Status != DeliveryPending
+	})
+	if delivery := service.Deliveries()[0]; delivery.Status != DeliveryAbandoned || atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("expected the retries to stop after 1 post, got %d posts and %+v", calls, delivery)
+	}
+}
+
+func TestDeliverHTTP_Closed(t *testing.T) {
+	service := NewSNS(sqs.NewSQS())
+	topic, _ := newHTTPSubscription(t, service, "http://localhost:1", nil)
+	service.Close()
+
+	publish(t, service, topic.Arn, "hello")
+	if deliveries := service.Deliveries(); len(deliveries) != 0 {
+		t.Errorf("expected no delivery once closed, got %+v", deliveries)
+	}
+}
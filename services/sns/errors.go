@@ -5,19 +5,25 @@ import (
 	"net/http"
 )
 
-var Errors = common.ErrorHandler{
-	"TopicNotFound": common.ErrorType{
+var (
+	ErrTopicNotFound = &common.ErrorType{
+		HttpError: http.StatusNotFound,
+		Type:      "Sender",
+		Code:      "NotFound",
+		Message:   "Topic does not exist"}
+	ErrSubscriptionNotFound = &common.ErrorType{
+		HttpError: http.StatusNotFound,
+		Type:      "Sender",
+		Code:      "NotFound",
+		Message:   "Subscription does not exist"}
+	ErrInvalidParameter = &common.ErrorType{
 		HttpError: http.StatusBadRequest,
-		Type:      "Not Found",
-		Code:      "AWS.SimpleNotificationService.NonExistentTopic",
-		Message:   "The specified topic does not exist for this wsdl version."},
-	"SubscriptionNotFound": common.ErrorType{
+		Type:      "Sender",
+		Code:      "InvalidParameter",
+		Message:   "Invalid parameter"}
+	ErrInvalidParameterValue = &common.ErrorType{
 		HttpError: http.StatusBadRequest,
-		Type:      "Not Found",
-		Code:      "AWS.SimpleNotificationService.NonExistentSubscription",
-		Message:   "The specified subscription does not exist for this wsdl version."},
-	"TopicExists": common.ErrorType{
-		HttpError: http.StatusBadRequest,
-		Type:      "Duplicate",
-		Code:      "AWS.SimpleNotificationService.TopicAlreadyExists",
-		Message:   "The specified topic already exists."}}
+		Type:      "Sender",
+		Code:      "ParameterValueInvalid",
+		Message:   "An invalid or out-of-range value was supplied for the input parameter."}
+)
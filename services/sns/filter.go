@@ -0,0 +1,380 @@
+package sns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Filter policy scopes, the part of a message a FilterPolicy is matched against
+const (
+	FilterPolicyScopeAttributes = "MessageAttributes"
+	FilterPolicyScopeBody       = "MessageBody"
+)
+
+// FilterPolicy selects the messages a subscription receives. Its keys name message attributes, or fields
+// of a JSON message body, and all must match. A key matches if one of the conditions of its array does:
+// a string, number or null to compare with, or an operator object: prefix, suffix, equals-ignore-case,
+// anything-but, numeric, exists or cidr. "$or" takes an array of policies one of which must match.
+type FilterPolicy struct {
+	policy map[string]interface{}
+}
+
+// ParseFilterPolicy reads and validates a FilterPolicy attribute
+func ParseFilterPolicy(value string) (*FilterPolicy, error) {
+	var policy map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("the filter policy is not a JSON object")
+	}
+	if err := validatePolicy(policy); err != nil {
+		return nil, err
+	}
+	return &FilterPolicy{policy: policy}, nil
+}
+
+func validatePolicy(policy map[string]interface{}) error {
+	for key, rule := range policy {
+		if key == "$or" {
+			alternatives, ok := rule.([]interface{})
+			if !ok || len(alternatives) < 2 {
+				return fmt.Errorf("$or must be an array of at least two filter policies")
+			}
+			for _, alternative := range alternatives {
+				nested, ok := alternative.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("$or must be an array of at least two filter policies")
+				}
+				if err := validatePolicy(nested); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		switch rule := rule.(type) {
+		case map[string]interface{}:
+			if err := validatePolicy(rule); err != nil {
+				return err
+			}
+		case []interface{}:
+			if len(rule) == 0 {
+				return fmt.Errorf("empty arrays are not allowed, key %s", key)
+			}
+			for _, condition := range rule {
+				if err := validateCondition(condition); err != nil {
+					return fmt.Errorf("%v, key %s", err, key)
+				}
+			}
+		default:
+			return fmt.Errorf("match value of key %s must be an array or an object", key)
+		}
+	}
+	return nil
+}
+
+func validateCondition(condition interface{}) error {
+	operator, ok := condition.(map[string]interface{})
+	if !ok {
+		switch condition.(type) {
+		case nil, string, json.Number, bool:
+			return nil
+		}
+		return fmt.Errorf("match value must be a string, number, null or operator object")
+	}
+	if len(operator) != 1 {
+		return fmt.Errorf("operator objects must have exactly one operator")
+	}
+	for name, operand := range operator {
+		switch name {
+		case "prefix", "suffix", "equals-ignore-case":
+			if s, ok := operand.(string); !ok || s == "" {
+				return fmt.Errorf("%s match pattern must be a non-empty string", name)
+			}
+		case "exists":
+			if _, ok := operand.(bool); !ok {
+				return fmt.Errorf("exists match pattern must be either true or false")
+			}
+		case "cidr":
+			s, ok := operand.(string)
+			if !ok {
+				return fmt.Errorf("malformed CIDR, one '/' required")
+			}
+			if _, _, err := net.ParseCIDR(s); err != nil {
+				return fmt.Errorf("malformed CIDR %s", s)
+			}
+		case "numeric":
+			if _, err := numericRange(operand); err != nil {
+				return err
+			}
+		case "anything-but":
+			return validateAnythingBut(operand)
+		default:
+			return fmt.Errorf("unrecognized match type %s", name)
+		}
+	}
+	return nil
+}
+
+func validateAnythingBut(operand interface{}) error {
+	switch operand := operand.(type) {
+	case string, json.Number:
+		return nil
+	case []interface{}:
+		for _, value := range operand {
+			switch value.(type) {
+			case string, json.Number:
+			default:
+				return fmt.Errorf("anything-but list must contain only strings or numbers")
+			}
+		}
+		return nil
+	case map[string]interface{}:
+		if len(operand) == 1 {
+			for name, value := range operand {
+				if s, ok := value.(string); ok && s != "" && (name == "prefix" || name == "suffix") {
+					return nil
+				}
+			}
+		}
+	}
+	return fmt.Errorf("anything-but takes a string, a number, a list of them or a prefix or suffix")
+}
+
+// comparison is one operator of a numeric condition
+type comparison struct {
+	operator string
+	value    float64
+}
+
+// numericRange reads the operand of a numeric condition: an operator and a number, optionally followed by a second pair
+func numericRange(operand interface{}) ([]comparison, error) {
+	values, ok := operand.([]interface{})
+	if !ok || (len(values) != 2 && len(values) != 4) {
+		return nil, fmt.Errorf("numeric match takes one or two operator and number pairs")
+	}
+	var comparisons []comparison
+	for i := 0; i < len(values); i += 2 {
+		operator, ok := values[i].(string)
+		number, isNumber := values[i+1].(json.Number)
+		if !ok || !isNumber {
+			return nil, fmt.Errorf("numeric match takes one or two operator and number pairs")
+		}
+		switch operator {
+		case "=", "<", "<=", ">", ">=":
+		default:
+			return nil, fmt.Errorf("unrecognized numeric range operator %s", operator)
+		}
+		value, err := number.Float64()
+		if err != nil {
+			return nil, err
+		}
+		comparisons = append(comparisons, comparison{operator: operator, value: value})
+	}
+	if len(comparisons) == 2 && (!strings.HasPrefix(comparisons[0].operator, ">") || !strings.HasPrefix(comparisons[1].operator, "<") || comparisons[0].value >= comparisons[1].value) {
+		return nil, fmt.Errorf("numeric ranges must be a lower bound followed by a greater upper bound")
+	}
+	return comparisons, nil
+}
+
+// MatchAttributes reports whether message attributes pass the policy. String.Array attributes match if one of
+// their elements does, Binary attributes are never matched.
+func (p *FilterPolicy) MatchAttributes(attributes []SnsMessageAttribute) bool {
+	values := make(map[string]interface{})
+	for _, attribute := range attributes {
+		switch {
+		case strings.HasPrefix(attribute.Type, "Number"):
+			values[attribute.Name] = json.Number(attribute.Value)
+		case strings.HasPrefix(attribute.Type, "String.Array"):
+			var array []interface{}
+			decoder := json.NewDecoder(strings.NewReader(attribute.Value))
+			decoder.UseNumber()
+			if decoder.Decode(&array) == nil {
+				values[attribute.Name] = array
+			}
+		case strings.HasPrefix(attribute.Type, "String"):
+			values[attribute.Name] = attribute.Value
+		}
+	}
+	return matchPolicy(p.policy, values)
+}
+
+// MatchBody reports whether a JSON message body passes the policy, other bodies never do
+func (p *FilterPolicy) MatchBody(body string) bool {
+	var values map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(body)))
+	decoder.UseNumber()
+	if decoder.Decode(&values) != nil {
+		return false
+	}
+	return matchPolicy(p.policy, values)
+}
+
+func matchPolicy(policy map[string]interface{}, values map[string]interface{}) bool {
+	for key, rule := range policy {
+		if key == "$or" {
+			matched := false
+			for _, alternative := range rule.([]interface{}) {
+				if matchPolicy(alternative.(map[string]interface{}), values) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+			continue
+		}
+		value, present := values[key]
+		switch rule := rule.(type) {
+		case map[string]interface{}:
+			nested, _ := value.(map[string]interface{})
+			if !matchPolicy(rule, nested) {
+				return false
+			}
+		case []interface{}:
+			if !matchConditions(rule, value, present) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchConditions reports whether one of the conditions matches a value, or one of its elements if it is an array
+func matchConditions(conditions []interface{}, value interface{}, present bool) bool {
+	for _, condition := range conditions {
+		if operator, ok := condition.(map[string]interface{}); ok {
+			if exists, ok := operator["exists"]; ok {
+				if present == exists.(bool) {
+					return true
+				}
+				continue
+			}
+		}
+		if !present {
+			continue
+		}
+		if array, ok := value.([]interface{}); ok {
+			for _, element := range array {
+				if matchCondition(condition, element) {
+					return true
+				}
+			}
+		} else if matchCondition(condition, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchCondition(condition interface{}, value interface{}) bool {
+	switch condition := condition.(type) {
+	case nil:
+		return value == nil
+	case string:
+		s, ok := value.(string)
+		return ok && s == condition
+	case bool:
+		b, ok := value.(bool)
+		return ok && b == condition
+	case json.Number:
+		return equalNumbers(condition, value)
+	case map[string]interface{}:
+		for name, operand := range condition {
+			return matchOperator(name, operand, value)
+		}
+	}
+	return false
+}
+
+func matchOperator(name string, operand interface{}, value interface{}) bool {
+	if name == "numeric" {
+		number, ok := toNumber(value)
+		if !ok {
+			return false
+		}
+		comparisons, _ := numericRange(operand)
+		for _, c := range comparisons {
+			if !compare(number, c) {
+				return false
+			}
+		}
+		return true
+	}
+	if name == "anything-but" {
+		return matchAnythingBut(operand, value)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return false
+	}
+	switch name {
+	case "prefix":
+		return strings.HasPrefix(s, operand.(string))
+	case "suffix":
+		return strings.HasSuffix(s, operand.(string))
+	case "equals-ignore-case":
+		return strings.EqualFold(s, operand.(string))
+	case "cidr":
+		_, network, _ := net.ParseCIDR(operand.(string))
+		ip := net.ParseIP(s)
+		return ip != nil && network.Contains(ip)
+	}
+	return false
+}
+
+func matchAnythingBut(operand interface{}, value interface{}) bool {
+	switch operand := operand.(type) {
+	case []interface{}:
+		for _, excluded := range operand {
+			if matchCondition(excluded, value) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		for name, pattern := range operand {
+			s, ok := value.(string)
+			return ok && !matchOperator(name, pattern, s)
+		}
+	}
+	return !matchCondition(operand, value)
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(string(number), 64)
+	return f, err == nil
+}
+
+func equalNumbers(condition json.Number, value interface{}) bool {
+	number, ok := toNumber(value)
+	if !ok {
+		return false
+	}
+	expected, err := condition.Float64()
+	return err == nil && expected == number
+}
+
+func compare(number float64, c comparison) bool {
+	switch c.operator {
+	case "=":
+		return number == c.value
+	case "<":
+		return number < c.value
+	case "<=":
+		return number <= c.value
+	case ">":
+		return number > c.value
+	case ">=":
+		return number >= c.value
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package sns
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/Tweddle-SE-Team/goaws/services/sqs"
+)
+
+func TestFilterPolicy_Attributes(t *testing.T) {
+	attributes := []SnsMessageAttribute{
+		{Name: "store", Type: "String", Value: "example_corp"},
+		{Name: "price", Type: "Number", Value: "210.75"},
+		{Name: "colors", Type: "String.Array", Value: `["red", "green"]`},
+		{Name: "source_ip", Type: "String", Value: "10.0.0.42"},
+		{Name: "payload", Type: "Binary", Value: "AQID"},
+	}
+	cases := []struct {
+		policy string
+		match  bool
+	}{
+		{`{"store": ["example_corp"]}`, true},
+		{`{"store": ["other_corp", "example_corp"]}`, true},
+		{`{"store": ["other_corp"]}`, false},
+		{`{"store": ["example_corp"], "price": [210.75]}`, true},
+		{`{"store": ["example_corp"], "price": [100]}`, false},
+		{`{"price": [210.750]}`, true},
+		{`{"price": ["210.75"]}`, false},
+		{`{"store": [{"prefix": "example"}]}`, true},
+		{`{"store": [{"suffix": "_corp"}]}`, true},
+		{`{"store": [{"suffix": "_inc"}]}`, false},
+		{`{"store": [{"equals-ignore-case": "EXAMPLE_Corp"}]}`, true},
+		{`{"store": [{"anything-but": "other_corp"}]}`, true},
+		{`{"store": [{"anything-but": ["example_corp", "other_corp"]}]}`, false},
+		{`{"store": [{"anything-but": {"prefix": "example"}}]}`, false},
+		{`{"store": [{"anything-but": {"suffix": "_inc"}}]}`, true},
+		{`{"missing": [{"anything-but": "x"}]}`, false},
+		{`{"price": [{"anything-but": [100, 200]}]}`, true},
+		{`{"price": [{"numeric": [">", 200]}]}`, true},
+		{`{"price": [{"numeric": [">", 0, "<=", 210.75]}]}`, true},
+		{`{"price": [{"numeric": [">=", 300, "<", 400]}]}`, false},
+		{`{"price": [{"numeric": ["=", 210.75]}]}`, true},
+		{`{"store": [{"numeric": [">", 0]}]}`, false},
+		{`{"store": [{"exists": true}]}`, true},
+		{`{"store": [{"exists": false}]}`, false},
+		{`{"missing": [{"exists": false}]}`, true},
+		{`{"missing": [{"exists": true}]}`, false},
+		{`{"payload": [{"exists": true}]}`, false},
+		{`{"colors": ["green"]}`, true},
+		{`{"colors": ["blue"]}`, false},
+		{`{"colors": [{"prefix": "re"}]}`, true},
+		{`{"source_ip": [{"cidr": "10.0.0.0/24"}]}`, true},
+		{`{"source_ip": [{"cidr": "10.0.1.0/24"}]}`, false},
+		{`{"$or": [{"store": ["other_corp"]}, {"price": [{"numeric": [">", 100]}]}]}`, true},
+		{`{"$or": [{"store": ["other_corp"]}, {"price": [{"numeric": ["<", 100]}]}]}`, false},
+		{`{"store": ["example_corp"], "$or": [{"colors": ["red"]}, {"missing": ["x"]}]}`, true},
+	}
+	for _, c := range cases {
+		policy, err := ParseFilterPolicy(c.policy)
+		if err != nil {
+			t.Errorf("%s: %v", c.policy, err)
+			continue
+		}
+		if match := policy.MatchAttributes(attributes); match != c.match {
+			t.Errorf("%s: expected match %v, got %v", c.policy, c.match, match)
+		}
+	}
+}
+
+func TestFilterPolicy_Body(t *testing.T) {
+	body := `{"order": {"type": "refund", "amount": 42, "tags": ["priority", "eu"], "note": null}, "region": "eu-west-1"}`
+	cases := []struct {
+		policy string
+		match  bool
+	}{
+		{`{"region": ["eu-west-1"]}`, true},
+		{`{"order": {"type": ["refund"]}}`, true},
+		{`{"order": {"type": ["purchase"]}}`, false},
+		{`{"order": {"amount": [{"numeric": [">", 40, "<", 50]}]}, "region": [{"prefix": "eu-"}]}`, true},
+		{`{"order": {"tags": ["eu"]}}`, true},
+		{`{"order": {"note": [null]}}`, true},
+		{`{"order": {"missing": [{"exists": false}]}}`, true},
+		{`{"customer": {"id": [{"exists": true}]}}`, false},
+		{`{"$or": [{"region": ["us-east-1"]}, {"order": {"type": ["refund"]}}]}`, true},
+	}
+	for _, c := range cases {
+		policy, err := ParseFilterPolicy(c.policy)
+		if err != nil {
+			t.Errorf("%s: %v", c.policy, err)
+			continue
+		}
+		if match := policy.MatchBody(body); match != c.match {
+			t.Errorf("%s: expected match %v, got %v", c.policy, c.match, match)
+		}
+	}
+	policy, _ := ParseFilterPolicy(`{"region": [{"exists": false}]}`)
+	if policy.MatchBody("not json") {
+		t.Error("expected a body which is not JSON not to match")
+	}
+}
+
+func TestParseFilterPolicy_Invalid(t *testing.T) {
+	for _, invalid := range []string{
+		`[]`,
+		`{"store": "example_corp"}`,
+		`{"store": []}`,
+		`{"store": [{"prefix": ""}]}`,
+		`{"store": [{"unknown": "x"}]}`,
+		`{"store": [{"prefix": "a", "suffix": "b"}]}`,
+		`{"price": [{"numeric": [">", "x"]}]}`,
+		`{"price": [{"numeric": ["<", 10, ">", 0]}]}`,
+		`{"price": [{"numeric": ["!=", 1]}]}`,
+		`{"ip": [{"cidr": "10.0.0.1"}]}`,
+		`{"store": [{"exists": "yes"}]}`,
+		`{"store": [{"anything-but": {"numeric": [">", 1]}}]}`,
+		`{"$or": [{"store": ["a"]}]}`,
+	} {
+		if _, err := ParseFilterPolicy(invalid); err == nil {
+			t.Errorf("expected %s to be rejected", invalid)
+		}
+	}
+}
+
+func TestPublish_FilterPolicy(t *testing.T) {
+	service := NewSNS(sqs.NewSQS())
+	name := "filtered-topic"
+	topic := NewTopic(nil, &name)
+	service.AddTopic(topic)
+	subscribe := func(queueName string, attributes map[string]string) *sqs.Queue {
+		queue := sqs.NewQueue(queueName, "localhost:4100")
+		service.SQS.AddQueue(queue)
+		subscription := NewSubscription(topic.Arn, "sqs", queue.Arn, false)
+		for name, value := range attributes {
+			if err := subscription.SetAttribute(name, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+		topic.Subscriptions.Put(subscription)
+		return queue
+	}
+	refunds := subscribe("refunds", map[string]string{"FilterPolicy": `{"event": ["refund"]}`})
+	large := subscribe("large", map[string]string{
+		"FilterPolicy":      `{"amount": [{"numeric": [">=", 100]}]}`,
+		"FilterPolicyScope": "MessageBody"})
+	all := subscribe("all", nil)
+
+	form := url.Values{}
+	form.Set("TopicArn", topic.Arn)
+	form.Set("Message", `{"amount": 150}`)
+	form.Set("MessageAttributes.entry.1.Name", "event")
+	form.Set("MessageAttributes.entry.1.Value.DataType", "String")
+	form.Set("MessageAttributes.entry.1.Value.StringValue", "purchase")
+	if _, _, err := service.Publish(newFormRequest(t, form)); err != nil {
+		t.Fatalf("Publish returned error: %v", err)
+	}
+	if refunds.Messages.Size() != 0 || large.Messages.Size() != 1 || all.Messages.Size() != 1 {
+		t.Errorf("expected the message to reach large and all only, got %d %d %d", refunds.Messages.Size(), large.Messages.Size(), all.Messages.Size())
+	}
+
+	subscription := NewSubscription(topic.Arn, "sqs", all.Arn, false)
+	if err := subscription.SetAttribute("FilterPolicyScope", "Everything"); err == nil {
+		t.Error("expected an unknown FilterPolicyScope to be rejected")
+	}
+}
@@ -0,0 +1,85 @@
+package sns
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+)
+
+// newToken returns a random subscription confirmation token
+func newToken() string {
+	token := make([]byte, 64)
+	rand.Read(token)
+	return hex.EncodeToString(token)
+}
+
+// baseURL is the URL the emulator was called at, links sent to endpoints point to it
+func baseURL(request *http.Request) string {
+	scheme := "http"
+	if request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + request.Host
+}
+
+// subscribeURL confirms a subscription when visited
+func subscribeURL(base string, subscription *Subscription) string {
+	query := url.Values{}
+	query.Set("Action", "ConfirmSubscription")
+	query.Set("TopicArn", subscription.TopicArn)
+	query.Set("Token", subscription.Token)
+	return base + "/?" + query.Encode()
+}
+
+// requestConfirmation posts the SubscriptionConfirmation message of a pending subscription in the background
+func (c *SNS) requestConfirmation(subscription *Subscription, base string) {
+	message := NewTopicMessage(
+		"SubscriptionConfirmation",
+		subscription.TopicArn,
+		fmt.Sprintf("You have chosen to subscribe to the topic %s.\nTo confirm the subscription, visit the SubscribeURL included in this message.", subscription.TopicArn),
+		nil,
+		"",
+		"")
+	message.Token = subscription.Token
+	message.base = base
+	message.SubscribeURL = subscribeURL(base, subscription)
+	c.deliverHTTP(subscription, message)
+}
+
+// post sends a message to the endpoint of a subscription with the headers AWS sets, endpoints must answer with a 2xx status
+func (c *SNS) post(subscription *Subscription, message *TopicMessage, contentType string) error {
+	body, err := c.bodyFor(subscription, message)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", subscription.EndPoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+	request.Header.Set("User-Agent", "Amazon Simple Notification Service Agent")
+	request.Header.Set("x-amz-sns-message-type", message.Type)
+	request.Header.Set("x-amz-sns-message-id", message.MessageId)
+	request.Header.Set("x-amz-sns-topic-arn", message.TopicArn)
+	if message.Type == "Notification" {
+		request.Header.Set("x-amz-sns-subscription-arn", subscription.SubscriptionArn)
+	}
+	if message.isRaw(subscription) {
+		request.Header.Set("x-amz-sns-rawdelivery", "true")
+	}
+	response, err := c.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("endpoint responded with %s", response.Status)
+	}
+	return nil
+}
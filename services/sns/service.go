@@ -1,9 +1,15 @@
 package sns
 
 import (
+	"crypto/rsa"
 	"github.com/Tweddle-SE-Team/goaws/services/common"
 	"github.com/Tweddle-SE-Team/goaws/services/common/queue"
+	"github.com/Tweddle-SE-Team/goaws/services/sqs"
+	"github.com/Tweddle-SE-Team/goaws/services/storage"
+	"net/http"
 	"strings"
+	"sync"
+	"time"
 )
 
 type (
@@ -13,10 +19,21 @@ type (
 
 const (
 	ProtocolSQS          Protocol         = "sqs"
+	ProtocolHTTP         Protocol         = "http"
+	ProtocolHTTPS        Protocol         = "https"
 	ProtocolDefault      Protocol         = "default"
 	MessageStructureJson MessageStructure = "json"
 )
 
+// IsValidProtocol reports whether Subscribe supports the protocol
+func IsValidProtocol(protocol string) bool {
+	switch protocol {
+	case "http", "https", "email", "email-json", "sms", "sqs", "application", "lambda", "firehose":
+		return true
+	}
+	return false
+}
+
 // Subscription struct
 
 type Subscription struct {
@@ -25,6 +42,14 @@ type Subscription struct {
 	SubscriptionArn string
 	EndPoint        string
 	Raw             bool
+	// PendingConfirmation is set until ConfirmSubscription is called with Token, http and https
+	// subscriptions receive no notifications before
+	PendingConfirmation bool
+	Token               string
+	DeliveryPolicy      string `json:",omitempty"`
+	RedrivePolicy       string `json:",omitempty"`
+	FilterPolicy        string `json:",omitempty"`
+	FilterPolicyScope   string `json:",omitempty"`
 }
 
 func NewSubscription(topicArn string, protocol string, endpoint string, raw bool) *Subscription {
@@ -38,22 +63,89 @@ func NewSubscription(topicArn string, protocol string, endpoint string, raw bool
 		Raw:             raw}
 }
 
+// RequiresConfirmation reports whether the endpoint must confirm the subscription before it is delivered to
+func (c *Subscription) RequiresConfirmation() bool {
+	return Protocol(c.Protocol) == ProtocolHTTP || Protocol(c.Protocol) == ProtocolHTTPS
+}
+
+// SetAttribute sets a subscription attribute of SetSubscriptionAttributes or Subscribe
+func (c *Subscription) SetAttribute(name string, value string) error {
+	switch name {
+	case "RawMessageDelivery":
+		c.Raw = value == "true"
+	case "DeliveryPolicy":
+		if value != "" {
+			if err := ValidateDeliveryPolicy(value); err != nil {
+				return ErrInvalidParameter.WithMessage("Invalid parameter: DeliveryPolicy: " + err.Error())
+			}
+		}
+		c.DeliveryPolicy = value
+	case "RedrivePolicy":
+		if value != "" {
+			if _, err := ParseSubscriptionRedrivePolicy(value); err != nil {
+				return ErrInvalidParameter.WithMessage("Invalid parameter: RedrivePolicy: " + err.Error())
+			}
+		}
+		c.RedrivePolicy = value
+	case "FilterPolicy":
+		if value != "" {
+			if _, err := ParseFilterPolicy(value); err != nil {
+				return ErrInvalidParameter.WithMessage("Invalid parameter: FilterPolicy: " + err.Error())
+			}
+		}
+		c.FilterPolicy = value
+	case "FilterPolicyScope":
+		if value != FilterPolicyScopeAttributes && value != FilterPolicyScopeBody {
+			return ErrInvalidParameter.WithMessage("Invalid parameter: FilterPolicyScope: Invalid value [" + value + "]. Please use either MessageBody or MessageAttributes")
+		}
+		c.FilterPolicyScope = value
+	default:
+		return ErrInvalidParameter.WithMessage("Invalid parameter: AttributeName")
+	}
+	return nil
+}
+
+// Accepts reports whether the filter policy of the subscription lets a message through
+func (c *Subscription) Accepts(message *TopicMessage) bool {
+	if c.FilterPolicy == "" {
+		return true
+	}
+	policy, err := ParseFilterPolicy(c.FilterPolicy)
+	if err != nil {
+		return false
+	}
+	if c.FilterPolicyScope == FilterPolicyScopeBody {
+		body, err := message.messageFor(c.Protocol)
+		return err == nil && policy.MatchBody(body)
+	}
+	return policy.MatchAttributes(message.attributes)
+}
+
+// DisplayArn is the ARN shown by ListSubscriptions, which AWS hides until the subscription is confirmed
+func (c *Subscription) DisplayArn() string {
+	if c.PendingConfirmation {
+		return "PendingConfirmation"
+	}
+	return c.SubscriptionArn
+}
+
 func (c *Subscription) GetTopicName() string {
 	uriSegments := strings.Split(c.TopicArn, ":")
 	return uriSegments[len(uriSegments)-1]
 }
 
-func (c *Subscription) getQueueName() string {
-	uriSegments := strings.Split(c.EndPoint, "/")
-	return uriSegments[len(uriSegments)-1]
+// subscriptionKeys indexes subscriptions by ARN
+func subscriptionKeys(v interface{}) []string {
+	return []string{v.(*Subscription).SubscriptionArn}
 }
 
 // Topic struct
 
 type Topic struct {
-	Name          string
-	Arn           string
-	Subscriptions *queue.BlockingQueue
+	Name           string
+	Arn            string
+	DeliveryPolicy string
+	Subscriptions  *queue.BlockingQueue
 }
 
 func NewTopic(arn *string, name *string) *Topic {
@@ -67,17 +159,104 @@ func NewTopic(arn *string, name *string) *Topic {
 		uriSegments := strings.Split(topicArn, ":")
 		topicName = uriSegments[len(uriSegments)-1]
 	}
-	return &Topic{Arn: topicArn, Name: topicName, Subscriptions: queue.New()}
+	return &Topic{Arn: topicArn, Name: topicName, Subscriptions: queue.NewIndexed(subscriptionKeys)}
+}
+
+// topicKeys indexes topics by ARN and name
+func topicKeys(v interface{}) []string {
+	topic := v.(*Topic)
+	return []string{"arn:" + topic.Arn, "name:" + topic.Name}
 }
 
 // SNS struct
 
 type SNS struct {
 	Topics *queue.BlockingQueue
+	// SQS holds the queues of sqs subscriptions
+	SQS *sqs.SQS
+	// Client posts to http and https subscriptions
+	Client *http.Client
+	// RetryDelayUnit is the unit of DeliveryPolicy delays, a second. Tests may shorten it
+	RetryDelayUnit time.Duration
+	store          storage.Store
+	lock           sync.Mutex
+
+	deliveries   []*Delivery
+	workers      sync.WaitGroup
+	done         chan struct{}
+	closed       bool
+	deliveryLock sync.Mutex
+
+	// signingKey signs the notifications of this service, it is generated with its certificate when first needed
+	signingKey         *rsa.PrivateKey
+	signingCertificate []byte
+	signingLock        sync.Mutex
+}
+
+// HTTPTimeout bounds a post to an http or https subscription
+const HTTPTimeout = 15 * time.Second
+
+func NewSNS(sqsService *sqs.SQS) *SNS {
+	return &SNS{
+		Topics:         queue.NewIndexed(topicKeys),
+		SQS:            sqsService,
+		Client:         &http.Client{Timeout: HTTPTimeout},
+		RetryDelayUnit: time.Second,
+		done:           make(chan struct{})}
+}
+
+func (c *SNS) GetTopic(topicArn string) *Topic {
+	if t := c.Topics.GetKey("arn:" + topicArn); t != nil {
+		return t.(*Topic)
+	}
+	return nil
 }
 
-func NewSNS() *SNS {
-	return &SNS{Topics: queue.New()}
+// GetTopicByName returns the topic with the name, or nil
+func (c *SNS) GetTopicByName(topicName string) *Topic {
+	if t := c.Topics.GetKey("name:" + topicName); t != nil {
+		return t.(*Topic)
+	}
+	return nil
 }
 
-var Service *SNS = NewSNS()
+// GetSubscription returns a subscription and its topic, found through the topic ARN the subscription ARN starts with
+func (c *SNS) GetSubscription(subscriptionArn string) (*Topic, *Subscription) {
+	i := strings.LastIndex(subscriptionArn, ":")
+	if i < 0 {
+		return nil, nil
+	}
+	topic := c.GetTopic(subscriptionArn[:i])
+	if topic == nil {
+		return nil, nil
+	}
+	if s := topic.Subscriptions.GetKey(subscriptionArn); s != nil {
+		return topic, s.(*Subscription)
+	}
+	return nil, nil
+}
+
+// updateTopic applies update to a copy of a topic, which replaces it and is persisted
+func (c *SNS) updateTopic(topic *Topic, update func(*Topic)) bool {
+	updated := *topic
+	update(&updated)
+	if !c.Topics.Replace("arn:"+topic.Arn, &updated) {
+		return false
+	}
+	c.saveTopic(&updated)
+	return true
+}
+
+// updateSubscription applies update to a copy of a subscription, which replaces it and is persisted.
+// Subscriptions are never changed in place, so deliveries can read them without locking.
+func (c *SNS) updateSubscription(topic *Topic, subscription *Subscription, update func(*Subscription) error) error {
+	updated := *subscription
+	if err := update(&updated); err != nil {
+		return err
+	}
+	if !topic.Subscriptions.Replace(subscription.SubscriptionArn, &updated) {
+		return ErrSubscriptionNotFound
+	}
+	c.saveTopic(topic)
+	return nil
+}
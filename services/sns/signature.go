@@ -0,0 +1,124 @@
+package sns
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SigningCertPath is where the emulator serves the certificate notifications are signed with
+const SigningCertPath = "/SimpleNotificationService-goaws.pem"
+
+// SignatureVersion 1 signs the SHA1 digest of a message with RSA, as AWS does by default
+const SignatureVersion = "1"
+
+// TimestampFormat is the format of the Timestamp of notifications, UTC with milliseconds
+const TimestampFormat = "2006-01-02T15:04:05.000Z"
+
+// loadSigningKey returns the key messages are signed with and its certificate, generated when the first message is signed
+func (c *SNS) loadSigningKey() (*rsa.PrivateKey, []byte, error) {
+	c.signingLock.Lock()
+	defer c.signingLock.Unlock()
+	if c.signingKey != nil {
+		return c.signingKey, c.signingCertificate, nil
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com", Organization: []string{"goaws"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.signingKey = key
+	c.signingCertificate = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate})
+	return c.signingKey, c.signingCertificate, nil
+}
+
+// SigningCertificate returns the PEM encoded certificate of the key messages are signed with
+func (c *SNS) SigningCertificate() ([]byte, error) {
+	_, certificate, err := c.loadSigningKey()
+	return certificate, err
+}
+
+// stringToSign lists the signed fields of a message and their values on separate lines, in the order AWS signs them
+func stringToSign(message *TopicMessage) string {
+	fields := []string{"Message", message.Message, "MessageId", message.MessageId}
+	if message.Type == "Notification" {
+		if message.Subject != "" {
+			fields = append(fields, "Subject", message.Subject)
+		}
+		fields = append(fields, "Timestamp", message.Timestamp, "TopicArn", message.TopicArn, "Type", message.Type)
+	} else {
+		fields = append(fields, "SubscribeURL", message.SubscribeURL, "Timestamp", message.Timestamp, "Token", message.Token,
+			"TopicArn", message.TopicArn, "Type", message.Type)
+	}
+	return strings.Join(fields, "\n") + "\n"
+}
+
+// sign sets the signature fields of a message
+func (c *SNS) sign(message *TopicMessage) error {
+	key, _, err := c.loadSigningKey()
+	if err != nil {
+		return err
+	}
+	digest := sha1.Sum([]byte(stringToSign(message)))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, digest[:])
+	if err != nil {
+		return err
+	}
+	message.SignatureVersion = SignatureVersion
+	message.Signature = base64.StdEncoding.EncodeToString(signature)
+	message.SigningCertURL = message.base + SigningCertPath
+	return nil
+}
+
+// unsubscribeURL deletes a subscription when visited
+func unsubscribeURL(base string, subscription *Subscription) string {
+	query := url.Values{}
+	query.Set("Action", "Unsubscribe")
+	query.Set("SubscriptionArn", subscription.SubscriptionArn)
+	return base + "/?" + query.Encode()
+}
+
+// envelope encodes the signed message a subscription receives when it is not raw
+func (c *SNS) envelope(subscription *Subscription, message *TopicMessage) ([]byte, error) {
+	topicMessage := *message
+	body, err := message.messageFor(subscription.Protocol)
+	if err != nil {
+		return nil, err
+	}
+	topicMessage.Message = body
+	if topicMessage.Type == "Notification" {
+		topicMessage.UnsubscribeURL = unsubscribeURL(message.base, subscription)
+	}
+	if err := c.sign(&topicMessage); err != nil {
+		return nil, err
+	}
+	// AWS does not escape the & of URLs
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(topicMessage); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,139 @@
+package sns
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Tweddle-SE-Team/goaws/services/sqs"
+)
+
+// verify checks the signature of a notification the way SNS clients do, with the fields AWS signs
+func verify(t *testing.T, service *SNS, message map[string]string) {
+	certificate, err := service.SigningCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(certificate)
+	if block == nil {
+		t.Fatal("expected a PEM certificate")
+	}
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{"Message", "MessageId", "Subject", "Timestamp", "TopicArn", "Type"}
+	if message["Type"] != "Notification" {
+		keys = []string{"Message", "MessageId", "SubscribeURL", "Timestamp", "Token", "TopicArn", "Type"}
+	}
+	signed := ""
+	for _, key := range keys {
+		if value, ok := message[key]; ok {
+			signed += key + "\n" + value + "\n"
+		}
+	}
+	signature, err := base64.StdEncoding.DecodeString(message["Signature"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha1.Sum([]byte(signed))
+	if err := rsa.VerifyPKCS1v15(parsed.PublicKey.(*rsa.PublicKey), crypto.SHA1, digest[:], signature); err != nil {
+		t.Errorf("invalid signature of %v: %v", message, err)
+	}
+}
+
+func TestEnvelope_Signed(t *testing.T) {
+	service := NewSNS(sqs.NewSQS())
+	queue := sqs.NewQueue("signed", "localhost:4100")
+	service.SQS.AddQueue(queue)
+	name := "signed-topic"
+	topic := NewTopic(nil, &name)
+	service.AddTopic(topic)
+	subscription := NewSubscription(topic.Arn, "sqs", queue.Arn, false)
+	topic.Subscriptions.Put(subscription)
+
+	form := url.Values{}
+	form.Set("TopicArn", topic.Arn)
+	form.Set("Message", "hello & <goodbye>")
+	form.Set("Subject", "greeting")
+	request := newFormRequest(t, form)
+	request.Host = "localhost:4100"
+	output, _, err := service.Publish(request)
+	if err != nil {
+		t.Fatalf("Publish returned error: %v", err)
+	}
+
+	body := string(queue.Messages.Pop().(*sqs.Message).MessageBody)
+	order := []string{`"Type"`, `"MessageId"`, `"TopicArn"`, `"Subject"`, `"Message"`, `"Timestamp"`, `"SignatureVersion"`, `"Signature"`, `"SigningCertURL"`, `"UnsubscribeURL"`}
+	position := 0
+	for _, field := range order {
+		i := strings.Index(body[position:], field+":")
+		if i < 0 {
+			t.Fatalf("expected %s after position %d of %s", field, position, body)
+		}
+		position += i
+	}
+	if strings.Contains(body, "MessageStructure") || strings.Contains(body, "TimeStamp") || !strings.Contains(body, "hello & <goodbye>") {
+		t.Errorf("unexpected fields in %s", body)
+	}
+
+	message := map[string]string{}
+	if err := json.Unmarshal([]byte(body), &message); err != nil {
+		t.Fatal(err)
+	}
+	if message["MessageId"] != output.(*PublishResponse).Result.MessageId {
+		t.Errorf("expected the published MessageId, got %s", message["MessageId"])
+	}
+	if _, err := time.Parse(TimestampFormat, message["Timestamp"]); err != nil || !strings.HasSuffix(message["Timestamp"], "Z") {
+		t.Errorf("unexpected Timestamp %q", message["Timestamp"])
+	}
+	if message["SignatureVersion"] != "1" || message["SigningCertURL"] != "http://localhost:4100"+SigningCertPath {
+		t.Errorf("unexpected signature fields %v", message)
+	}
+	if message["UnsubscribeURL"] != unsubscribeURL("http://localhost:4100", subscription) {
+		t.Errorf("unexpected UnsubscribeURL %s", message["UnsubscribeURL"])
+	}
+	verify(t, service, message)
+}
+
+func TestEnvelope_SignedConfirmation(t *testing.T) {
+	endpoint, posted := newEndpoint(t)
+	service := NewSNS(sqs.NewSQS())
+	defer service.Close()
+	name := "confirmed-topic"
+	topic := NewTopic(nil, &name)
+	service.AddTopic(topic)
+	subscription := NewSubscription(topic.Arn, "http", endpoint.URL, false)
+	subscription.PendingConfirmation = true
+	subscription.Token = newToken()
+	topic.Subscriptions.Put(subscription)
+
+	service.requestConfirmation(subscription, "http://localhost:4100")
+	message := nextPost(t, posted).message
+	if _, ok := message["UnsubscribeURL"]; ok || message["Token"] != subscription.Token {
+		t.Errorf("unexpected confirmation %v", message)
+	}
+	verify(t, service, message)
+}
+
+func TestSigningCertificate_PerService(t *testing.T) {
+	first, second := NewSNS(sqs.NewSQS()), NewSNS(sqs.NewSQS())
+	certificate, err := first.SigningCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := first.SigningCertificate(); string(again) != string(certificate) {
+		t.Error("expected a service to keep its certificate")
+	}
+	if other, _ := second.SigningCertificate(); string(other) == string(certificate) {
+		t.Error("expected each service to have its own certificate")
+	}
+}
@@ -8,7 +8,7 @@ import (
 type SNSAPI interface {
 	//AddPermission(*http.Request) (interface{}, string, error)
 	//CheckIfPhoneNumberIsOptedOut(*http.Request) (interface{}, string, error)
-	//ConfirmSubscription(*http.Request) (interface{}, string, error)
+	ConfirmSubscription(*http.Request) (interface{}, string, error)
 	//CreatePlatformApplication(*http.Request) (interface{}, string, error)
 	//CreatePlatformEndpoint(*http.Request) (interface{}, string, error)
 	CreateTopic(*http.Request) (interface{}, string, error)
@@ -33,7 +33,7 @@ type SNSAPI interface {
 	//SetPlatformApplicationAttributes(*http.Request) (interface{}, string, error)
 	//SetSMSAttributes(*http.Request) (interface{}, string, error)
 	SetSubscriptionAttributes(*http.Request) (interface{}, string, error)
-	//SetTopicAttributes(*http.Request) (interface{}, string, error)
+	SetTopicAttributes(*http.Request) (interface{}, string, error)
 	Subscribe(*http.Request) (interface{}, string, error)
 	Unsubscribe(*http.Request) (interface{}, string, error)
 }
@@ -0,0 +1,137 @@
+package sns
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/Tweddle-SE-Team/goaws/services/common/queue"
+	"github.com/Tweddle-SE-Team/goaws/services/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+// Bucket topics are persisted in together with their subscriptions, keyed by topic ARN
+const topicsBucket = "sns.topics"
+
+// TopicRecord is the persisted form of a topic and its subscriptions
+type TopicRecord struct {
+	Name           string
+	Arn            string
+	DeliveryPolicy string `json:",omitempty"`
+	Subscriptions  []Subscription
+}
+
+func (topic *Topic) record() TopicRecord {
+	record := TopicRecord{Name: topic.Name, Arn: topic.Arn, DeliveryPolicy: topic.DeliveryPolicy, Subscriptions: []Subscription{}}
+	for s := range topic.Subscriptions.Iterator() {
+		record.Subscriptions = append(record.Subscriptions, *s.(*Subscription))
+	}
+	return record
+}
+
+func newTopicFromRecord(record TopicRecord) *Topic {
+	topic := &Topic{Name: record.Name, Arn: record.Arn, DeliveryPolicy: record.DeliveryPolicy, Subscriptions: queue.NewIndexed(subscriptionKeys)}
+	for i := range record.Subscriptions {
+		subscription := record.Subscriptions[i]
+		topic.Subscriptions.Put(&subscription)
+	}
+	return topic
+}
+
+// saveTopic writes a topic and its subscriptions to the store
+func (c *SNS) saveTopic(topic *Topic) {
+	c.lock.Lock()
+	store := c.store
+	c.lock.Unlock()
+	if store == nil {
+		return
+	}
+	value, err := json.Marshal(topic.record())
+	if err == nil {
+		err = store.Put(topicsBucket, topic.Arn, value)
+	}
+	if err != nil {
+		log.Errorf("Failed to write topic %s to storage: %v", topic.Arn, err)
+	}
+}
+
+// AddTopic registers a topic and persists it
+func (c *SNS) AddTopic(topic *Topic) {
+	c.saveTopic(topic)
+	c.Topics.Put(topic)
+}
+
+// RemoveTopic unregisters a topic and its subscriptions, returns false if there is no such topic
+func (c *SNS) RemoveTopic(topicArn string) bool {
+	if c.Topics.RemoveKey("arn:"+topicArn) == nil {
+		return false
+	}
+	c.lock.Lock()
+	store := c.store
+	c.lock.Unlock()
+	if store != nil {
+		if err := store.Delete(topicsBucket, topicArn); err != nil {
+			log.Errorf("Failed to delete topic %s from storage: %v", topicArn, err)
+		}
+	}
+	return true
+}
+
+// SetStore selects the store topics and subscriptions are persisted in and restores what it holds, a nil store persists nothing
+func (c *SNS) SetStore(store storage.Store) error {
+	c.lock.Lock()
+	c.store = store
+	c.lock.Unlock()
+	if store == nil {
+		return nil
+	}
+
+	restored := make(map[string]bool)
+	err := store.ForEach(topicsBucket, func(key string, value []byte) error {
+		var record TopicRecord
+		if err := json.Unmarshal(value, &record); err != nil {
+			return err
+		}
+		topic := newTopicFromRecord(record)
+		c.Topics.RemoveKey("arn:" + topic.Arn)
+		c.Topics.Put(topic)
+		restored[topic.Arn] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Topics created before the store was selected are persisted too
+	for t := range c.Topics.Iterator() {
+		if topic := t.(*Topic); !restored[topic.Arn] {
+			c.saveTopic(topic)
+		}
+	}
+	return nil
+}
+
+// Snapshot captures every topic with its subscriptions
+func (c *SNS) Snapshot() []TopicRecord {
+	records := []TopicRecord{}
+	for t := range c.Topics.Iterator() {
+		records = append(records, t.(*Topic).record())
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Arn < records[j].Arn
+	})
+	return records
+}
+
+// Restore replaces every topic with the ones of the snapshot and persists them
+func (c *SNS) Restore(records []TopicRecord) {
+	var arns []string
+	for t := range c.Topics.Iterator() {
+		arns = append(arns, t.(*Topic).Arn)
+	}
+	for _, arn := range arns {
+		c.RemoveTopic(arn)
+	}
+	for _, record := range records {
+		c.AddTopic(newTopicFromRecord(record))
+	}
+}
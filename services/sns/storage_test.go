@@ -0,0 +1,39 @@
+package sns
+
+import (
+	"testing"
+
+	"github.com/Tweddle-SE-Team/goaws/services/sqs"
+	"github.com/Tweddle-SE-Team/goaws/services/storage"
+)
+
+func TestSetStore_RestoresTopicsAndSubscriptions(t *testing.T) {
+	store := storage.NewMemoryStore()
+	service := NewSNS(sqs.NewSQS())
+	service.SetStore(store)
+	name := "persistent-topic"
+	topic := NewTopic(nil, &name)
+	service.AddTopic(topic)
+	subscription := NewSubscription(topic.Arn, "sqs", "http://localhost:4100/queue/subscriber", true)
+	topic.Subscriptions.Put(subscription)
+	service.saveTopic(topic)
+	other := "deleted-topic"
+	service.AddTopic(NewTopic(nil, &other))
+	service.RemoveTopic("arn:aws:sns:local:000000000000:deleted-topic")
+
+	restored := NewSNS(sqs.NewSQS())
+	if err := restored.SetStore(store); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Topics.Size() != 1 {
+		t.Fatalf("expected 1 topic, got %d", restored.Topics.Size())
+	}
+	restoredTopic := restored.GetTopic(topic.Arn)
+	if restoredTopic == nil || restoredTopic.Subscriptions.Size() != 1 {
+		t.Fatalf("expected the topic and its subscription to be restored")
+	}
+	restoredSubscription := restoredTopic.Subscriptions.Pop().(*Subscription)
+	if *restoredSubscription != *subscription {
+		t.Errorf("expected subscription %+v, got %+v", *subscription, *restoredSubscription)
+	}
+}
@@ -0,0 +1,43 @@
+package sqs
+
+import (
+	"net/http"
+)
+
+// Admin endpoints are not part of the SQS API, they expose emulator internals as JSON
+
+type QueueStatistics struct {
+	Name                   string
+	URL                    string
+	Arn                    string
+	Messages               int
+	MessagesNotVisible     int
+	MessagesDelayed        int
+	ExpiredMessages        int
+	MessageRetentionPeriod int
+}
+
+type QueueStatisticsResponse struct {
+	Queues []QueueStatistics
+}
+
+func (c *SQS) QueueStatistics(request *http.Request) (interface{}, string, error) {
+	statistics := []QueueStatistics{}
+	for q := range c.Queues.Iterator() {
+		queue := q.(*Queue)
+		notVisible := queue.InFlightSize()
+		delayed := queue.DelayedSize()
+		queue.lock.Lock()
+		statistics = append(statistics, QueueStatistics{
+			Name:                   queue.Name,
+			URL:                    queue.URL,
+			Arn:                    queue.Arn,
+			Messages:               queue.Messages.Size(),
+			MessagesNotVisible:     notVisible,
+			MessagesDelayed:        delayed,
+			ExpiredMessages:        queue.ExpiredMessages,
+			MessageRetentionPeriod: queue.MessageRetentionPeriod})
+		queue.lock.Unlock()
+	}
+	return &QueueStatisticsResponse{Queues: statistics}, "JSON", nil
+}
@@ -1,84 +1,157 @@
 package sqs
 
 import (
-	"errors"
 	"fmt"
 	"github.com/Tweddle-SE-Team/goaws/services/common"
 	log "github.com/sirupsen/logrus"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
+func (c *SQS) ChangeMessageVisibility(request *http.Request) (interface{}, string, error) {
+	receiptHandle := request.FormValue("ReceiptHandle")
+	visibilityTimeout, err := strconv.Atoi(request.FormValue("VisibilityTimeout"))
+	if err != nil || visibilityTimeout < 0 || visibilityTimeout > 43200 {
+		return nil, "XML", ErrInvalidVisibilityTimeout
+	}
+	queue := c.GetQueue(GetQueueNameFromRequest(request))
+	if queue == nil {
+		return nil, "XML", ErrQueueDoesNotExist
+	}
+	if err := queue.ChangeVisibilityTimeout(receiptHandle, time.Duration(visibilityTimeout)*time.Second); err != nil {
+		return nil, "XML", err
+	}
+	return NewChangeMessageVisibilityResponse(common.RequestId(request)), "XML", nil
+}
+
+func (c *SQS) ChangeMessageVisibilityBatch(request *http.Request) (interface{}, string, error) {
+	queue := c.GetQueue(GetQueueNameFromRequest(request))
+	if queue == nil {
+		return nil, "XML", ErrQueueDoesNotExist
+	}
+	// the whole batch is validated before any entry is applied
+	type entry struct {
+		id            string
+		receiptHandle string
+		timeout       string
+	}
+	entries := []entry{}
+	ids := make(map[string]bool)
+	for i := 1; true; i++ {
+		prefix := fmt.Sprintf("ChangeMessageVisibilityBatchRequestEntry.%d.", i)
+		id := request.FormValue(prefix + "Id")
+		if id == "" {
+			break
+		}
+		if !IsValidBatchEntryId(id) {
+			return nil, "XML", ErrInvalidBatchEntryId
+		}
+		if ids[id] {
+			return nil, "XML", ErrBatchEntryIdsNotDistinct
+		}
+		ids[id] = true
+		if len(ids) > 10 {
+			return nil, "XML", ErrTooManyEntriesInBatchRequest
+		}
+		entries = append(entries, entry{id: id, receiptHandle: request.FormValue(prefix + "ReceiptHandle"), timeout: request.FormValue(prefix + "VisibilityTimeout")})
+	}
+	if len(entries) == 0 {
+		return nil, "XML", ErrEmptyBatchRequest
+	}
+	changedEntries := []ChangeMessageVisibilityBatchResultEntry{}
+	failedEntries := []BatchResultErrorEntry{}
+	for _, entry := range entries {
+		visibilityTimeout, err := strconv.Atoi(entry.timeout)
+		if err != nil || visibilityTimeout < 0 || visibilityTimeout > 43200 {
+			err = ErrInvalidVisibilityTimeout
+		} else {
+			err = queue.ChangeVisibilityTimeout(entry.receiptHandle, time.Duration(visibilityTimeout)*time.Second)
+		}
+		if err != nil {
+			failedEntries = append(failedEntries, NewBatchResultErrorEntry(entry.id, err))
+		} else {
+			changedEntries = append(changedEntries, ChangeMessageVisibilityBatchResultEntry{Id: entry.id})
+		}
+	}
+	return NewChangeMessageVisibilityBatchResponse(common.RequestId(request),
+		ChangeMessageVisibilityBatchResult{
+			Entry: changedEntries,
+			Error: failedEntries}), "XML", nil
+}
+
 func (c *SQS) CreateQueue(request *http.Request) (interface{}, string, error) {
-	queue := NewQueue(request.FormValue("QueueName"), request.Host)
-	queueEquals := func(src interface{}, value interface{}) bool {
-		return src.(*Queue).Name == value.(*Queue).Name
+	queueName := request.FormValue("QueueName")
+	if queueName == "" {
+		return nil, "XML", ErrMissingParameter.WithMessage("The request must contain the parameter QueueName.")
+	}
+	if err := common.ValidateQueueName(queueName); err != nil {
+		return nil, "XML", ErrInvalidParameterValue.WithMessage("Can only include alphanumeric characters, hyphens, or underscores. 1 to 80 in length")
 	}
-	if c.Queues.Get(queue, queueEquals) != nil {
-		c.Queues.Put(queue)
+	attributes := ExtractQueueAttributes(request)
+	if (attributes["FifoQueue"] == "true") != strings.HasSuffix(queueName, ".fifo") {
+		return nil, "XML", ErrInvalidFifoQueueName
 	}
-	return NewCreateQueueResponse(CreateQueueResult{QueueUrl: queue.URL}), "XML", nil
+	// FifoQueue can only be given at creation and is derived from the name
+	delete(attributes, "FifoQueue")
+	if queue := c.GetQueue(queueName); queue != nil {
+		if !queue.HasAttributes(attributes) {
+			return nil, "XML", ErrQueueAlreadyExists
+		}
+		return NewCreateQueueResponse(common.RequestId(request), CreateQueueResult{QueueUrl: queue.URL}), "XML", nil
+	}
+	if c.DeletedRecently(queueName) {
+		return nil, "XML", ErrQueueDeletedRecently
+	}
+	queue := NewQueue(queueName, request.Host)
+	if err := queue.SetAttributes(attributes); err != nil {
+		return nil, "XML", err
+	}
+	c.AddQueue(queue)
+	return NewCreateQueueResponse(common.RequestId(request), CreateQueueResult{QueueUrl: queue.URL}), "XML", nil
 }
 
 func (c *SQS) DeleteMessage(request *http.Request) (interface{}, string, error) {
 	receiptHandle := request.FormValue("ReceiptHandle")
 	queueName := GetQueueNameFromRequest(request)
-	queue := NewQueue(queueName, request.Host)
-	messageEquals := func(src interface{}, value interface{}) bool {
-		return src.(Message).ReceiptHandle == value.(string)
+	queue := c.GetQueue(queueName)
+	if queue == nil {
+		return nil, "XML", ErrQueueDoesNotExist
 	}
-	queueEquals := func(src interface{}, value interface{}) bool {
-		return src.(*Queue).Name == value.(*Queue).Name
+	if queue.DeleteMessage(receiptHandle) {
+		return NewDeleteMessageResponse(common.RequestId(request)), "XML", nil
 	}
-	if q := c.Queues.Get(&queue, queueEquals); q != nil {
-		if queue.Messages.Remove(&receiptHandle, messageEquals) {
-			return NewDeleteMessageResponse(), "XML", nil
-		}
-	}
-	return nil, "XML", errors.New("MessageDoesNotExist")
+	return nil, "XML", ErrReceiptHandleIsInvalid
 }
 
 func (c *SQS) DeleteMessageBatch(request *http.Request) (interface{}, string, error) {
 	queueName := GetQueueNameFromRequest(request)
-	queue := NewQueue(queueName, request.Host)
+	queue := c.GetQueue(queueName)
+	if queue == nil {
+		return nil, "XML", ErrQueueDoesNotExist
+	}
 	deletedResultEntries := []DeleteMessageBatchResultEntry{}
 	notFoundEntries := []BatchResultErrorEntry{}
-	queueEquals := func(src interface{}, value interface{}) bool {
-		return src.(*Queue).Name == value.(*Queue).Name
-	}
-	messageEquals := func(src interface{}, value interface{}) bool {
-		return src.(*Message).ReceiptHandle == value.(*DeleteEntry).ReceiptHandle
-	}
-	for i := 2; true; i++ {
+	for i := 1; true; i++ {
 		messageId := request.FormValue(fmt.Sprintf("DeleteMessageBatchRequestEntry.%d.Id", i))
 		receiptHandle := request.FormValue(fmt.Sprintf("DeleteMessageBatchRequestEntry.%d.ReceiptHandle", i))
 		if messageId != "" && receiptHandle != "" {
 			deleteEntry := DeleteEntry{
 				Id:            messageId,
 				ReceiptHandle: receiptHandle,
-				Deleted:       false}
-			if q := c.Queues.Get(queue, queueEquals); q != nil {
-				if q.(Queue).Messages.Remove(&deleteEntry, messageEquals) {
-					deleteEntry.Deleted = true
-				}
-			}
+				Deleted:       queue.DeleteMessage(receiptHandle)}
 			if deleteEntry.Deleted == true {
 				deletedResultEntries = append(deletedResultEntries, DeleteMessageBatchResultEntry{Id: deleteEntry.Id})
 			} else {
-				notFoundEntries = append(notFoundEntries,
-					BatchResultErrorEntry{
-						Code:        "1",
-						Id:          deleteEntry.Id,
-						Message:     "Message not found",
-						SenderFault: true})
+				notFoundEntries = append(notFoundEntries, NewBatchResultErrorEntry(deleteEntry.Id, ErrReceiptHandleIsInvalid))
 			}
 		} else {
 			break
 		}
 	}
 
-	return NewDeleteMessageBatchResponse(
+	return NewDeleteMessageBatchResponse(common.RequestId(request),
 		DeleteMessageBatchResult{
 			Entry: deletedResultEntries,
 			Error: notFoundEntries}), "XML", nil
@@ -86,148 +159,262 @@ func (c *SQS) DeleteMessageBatch(request *http.Request) (interface{}, string, er
 
 func (c *SQS) DeleteQueue(request *http.Request) (interface{}, string, error) {
 	queueName := GetQueueNameFromRequest(request)
-	queueEquals := func(s interface{}, v interface{}) bool {
-		src := s.(*Queue)
-		value := v.(*string)
-		return src.Name == *value
+	if !c.RemoveQueue(queueName) {
+		return nil, "XML", ErrQueueDoesNotExist
 	}
-	c.Queues.Remove(&queueName, queueEquals)
-	return NewDeleteQueueResponse(), "XML", nil
+	c.lock.Lock()
+	c.deletedQueues[queueName] = time.Now()
+	c.lock.Unlock()
+	return NewDeleteQueueResponse(common.RequestId(request)), "XML", nil
 }
 
 func (c *SQS) GetQueueAttributes(request *http.Request) (interface{}, string, error) {
 	queueName := GetQueueNameFromRequest(request)
-	queueEquals := func(s interface{}, v interface{}) bool {
-		src := s.(*Queue)
-		value := v.(*string)
-		return src.Name == *value
-	}
-	if q := c.Queues.Get(&queueName, queueEquals); q != nil {
-		result := GetQueueAttributesResult{Attrs: []Attribute{
-			Attribute{Name: "VisibilityTimeout", Value: strconv.Itoa(q.(*Queue).TimeoutSecs)},
-			Attribute{Name: "DelaySeconds", Value: "0"},
-			Attribute{Name: "ReceiveMessageWaitTimeSeconds", Value: "0"},
-			Attribute{Name: "ApproximateNumberOfMessages", Value: strconv.Itoa(q.(*Queue).Messages.Size())},
-			Attribute{Name: "ApproximateNumberOfMessagesNotVisible", Value: "0"},
-			Attribute{Name: "CreatedTimestamp", Value: "0000000000"},
-			Attribute{Name: "LastModifiedTimestamp", Value: "0000000000"},
-			Attribute{Name: "QueueArn", Value: q.(*Queue).Arn},
-		}}
-		return NewGetQueueAttributesResponse(result), "XML", nil
-	} else {
-		return nil, "XML", errors.New("QueueNotFound")
+	queue := c.GetQueue(queueName)
+	if queue == nil {
+		return nil, "XML", ErrQueueDoesNotExist
 	}
+	attributes, err := queue.GetAttributes(ExtractAttributeNames(request, "AttributeName"))
+	if err != nil {
+		return nil, "XML", err
+	}
+	return NewGetQueueAttributesResponse(common.RequestId(request), GetQueueAttributesResult{Attrs: attributes}), "XML", nil
 }
 
 func (c *SQS) GetQueueUrl(request *http.Request) (interface{}, string, error) {
 	queueName := request.FormValue("QueueName")
-	queueEquals := func(s interface{}, v interface{}) bool {
-		src := s.(*Queue)
-		value := v.(*string)
-		return src.Name == *value
+	if queueName == "" {
+		return nil, "XML", ErrMissingParameter.WithMessage("The request must contain the parameter QueueName.")
 	}
-	if q := c.Queues.Get(&queueName, queueEquals); q != nil {
-		return NewGetQueueUrlResponse(GetQueueUrlResult{QueueUrl: q.(*Queue).URL}), "XML", nil
+	if q := c.GetQueue(queueName); q != nil {
+		return NewGetQueueUrlResponse(common.RequestId(request), GetQueueUrlResult{QueueUrl: q.URL}), "XML", nil
 	} else {
-		return nil, "XML", errors.New("QueueNotFound")
+		return nil, "XML", ErrQueueDoesNotExist
 	}
 }
 
+func (c *SQS) ListDeadLetterSourceQueues(request *http.Request) (interface{}, string, error) {
+	queueName := GetQueueNameFromRequest(request)
+	deadLetterQueue := c.GetQueue(queueName)
+	if deadLetterQueue == nil {
+		return nil, "XML", ErrQueueDoesNotExist
+	}
+	queueUrls := make([]string, 0)
+	for q := range c.Queues.Iterator() {
+		queue := q.(*Queue)
+		if redrivePolicy := queue.GetRedrivePolicy(); redrivePolicy != nil && redrivePolicy.DeadLetterTargetArn == deadLetterQueue.Arn {
+			queueUrls = append(queueUrls, queue.URL)
+		}
+	}
+	return NewListDeadLetterSourceQueuesResponse(common.RequestId(request), ListDeadLetterSourceQueuesResult{QueueUrl: queueUrls}), "XML", nil
+}
+
 func (c *SQS) ListQueues(request *http.Request) (interface{}, string, error) {
 	queueUrls := make([]string, 0)
 	for q := range c.Queues.Iterator() {
 		queue := q.(*Queue)
 		queueUrls = append(queueUrls, queue.URL)
 	}
-	return NewListQueuesResponse(ListQueuesResult{QueueUrl: queueUrls}), "XML", nil
+	return NewListQueuesResponse(common.RequestId(request), ListQueuesResult{QueueUrl: queueUrls}), "XML", nil
 }
 
 func (c *SQS) PurgeQueue(request *http.Request) (interface{}, string, error) {
 	queueName := GetQueueNameFromRequest(request)
-	queueEquals := func(s interface{}, v interface{}) bool {
-		src := s.(*Queue)
-		value := v.(*string)
-		return src.Name == *value
-	}
-	if q := c.Queues.Get(&queueName, queueEquals); q != nil {
-		q.(*Queue).Messages.Empty()
-		return NewPurgeQueueResponse(), "XML", nil
+	if q := c.GetQueue(queueName); q != nil {
+		q.Purge()
+		return NewPurgeQueueResponse(common.RequestId(request)), "XML", nil
 	} else {
-		return nil, "XML", errors.New("QueueNotFound")
+		return nil, "XML", ErrQueueDoesNotExist
 	}
 }
 
 func (c *SQS) ReceiveMessage(request *http.Request) (interface{}, string, error) {
 	receiveParameters := map[string]int{
-		"waitTimeSeconds":     0,
-		"maxNumberOfMessages": 1}
+		"WaitTimeSeconds":     -1,
+		"MaxNumberOfMessages": 1,
+		"VisibilityTimeout":   -1}
 	for key, _ := range receiveParameters {
 		if param := request.FormValue(key); param != "" {
-			receiveParameters[key], _ = strconv.Atoi(param)
+			value, err := strconv.Atoi(param)
+			if err != nil || value < 0 {
+				return nil, "XML", ErrInvalidParameterValue.WithMessage(fmt.Sprintf("Value %s for parameter %s is invalid.", param, key))
+			}
+			receiveParameters[key] = value
 		}
 	}
-	queueName := GetQueueNameFromRequest(request)
-	queueEquals := func(s interface{}, v interface{}) bool {
-		src := s.(*Queue)
-		value := v.(*string)
-		return src.Name == *value
+	if maxNumberOfMessages := receiveParameters["MaxNumberOfMessages"]; maxNumberOfMessages < 1 || maxNumberOfMessages > 10 {
+		return nil, "XML", ErrInvalidParameterValue.WithMessage(fmt.Sprintf("Value %d for parameter MaxNumberOfMessages is invalid. Reason: Must be between 1 and 10, if provided.", maxNumberOfMessages))
 	}
-	messageEquals := func(src interface{}, value interface{}) bool {
-		return src.(*Message).ReceiptHandle == value.(*Message).ReceiptHandle
+	if receiveParameters["VisibilityTimeout"] > 43200 {
+		return nil, "XML", ErrInvalidVisibilityTimeout
 	}
-	log.Warnf("Queue Name %+v", queueName)
-	queue := c.Queues.Get(&queueName, queueEquals)
+	queueName := GetQueueNameFromRequest(request)
+	log.Debugf("Queue Name %+v", queueName)
+	queue := c.GetQueue(queueName)
 	if queue == nil {
-		return nil, "XML", errors.New("QueueNotFound")
-	}
-	time.Sleep(1000 * time.Millisecond * time.Duration(receiveParameters["waitTimeSeconds"]))
-	var resultMessages []*Message
-	if queue.(*Queue).Messages.Size() > 0 {
-		for m := range queue.(*Queue).Messages.Iterator() {
-			if receiveParameters["maxNumberOfMessages"] <= 0 {
-				break
-			} else {
-				receiveParameters["maxNumberOfMessages"]--
-			}
-			message := m.(*Message)
-			message.UpdateReceiptHandle()
-			resultMessages = append(resultMessages, message)
-			queue.(*Queue).Messages.Remove(message, messageEquals)
+		return nil, "XML", ErrQueueDoesNotExist
+	}
+	waitTimeSeconds, visibilityTimeout := queue.ReceiveDefaults()
+	if receiveParameters["WaitTimeSeconds"] >= 0 {
+		waitTimeSeconds = receiveParameters["WaitTimeSeconds"]
+	}
+	if waitTimeSeconds > 20 {
+		return nil, "XML", ErrInvalidWaitTimeSeconds
+	}
+	if receiveParameters["VisibilityTimeout"] >= 0 {
+		visibilityTimeout = receiveParameters["VisibilityTimeout"]
+	}
+	deadline := time.Now().Add(time.Duration(waitTimeSeconds) * time.Second)
+	maxNumberOfMessages := receiveParameters["MaxNumberOfMessages"]
+	deadLetterQueue := c.GetDeadLetterQueue(queue)
+	messages := queue.ReceiveMessages(maxNumberOfMessages, time.Duration(visibilityTimeout)*time.Second, deadLetterQueue)
+	for len(messages) == 0 {
+		// Long polling: block until a message is put on the queue, the wait time elapses or the client goes away
+		remaining := deadline.Sub(time.Now())
+		if remaining <= 0 || !queue.Messages.Wait(remaining, request.Context().Done(), queue.HasVisibleMessages) {
+			break
 		}
-		return NewReceiveMessageResponse(ReceiveMessageResult{Message: resultMessages}), "XML", nil
-	} else {
-		return NewReceiveMessageResponse(ReceiveMessageResult{}), "XML", nil
+		messages = queue.ReceiveMessages(maxNumberOfMessages, time.Duration(visibilityTimeout)*time.Second, deadLetterQueue)
+	}
+	attributeNames := append(ExtractAttributeNames(request, "AttributeName"), ExtractAttributeNames(request, "MessageSystemAttributeName")...)
+	messageAttributeNames := ExtractAttributeNames(request, "MessageAttributeName")
+	receivedMessages := []*Message{}
+	for _, message := range messages {
+		receivedMessages = append(receivedMessages, c.ReceivedMessage(queue, message, attributeNames, messageAttributeNames))
 	}
+	return NewReceiveMessageResponse(common.RequestId(request), ReceiveMessageResult{Message: receivedMessages}), "XML", nil
 }
 
 func (c *SQS) SendMessage(request *http.Request) (interface{}, string, error) {
-	messageBody := request.FormValue("MessageBody")
-	messageAttributes, md5OfMessageAttributes := c.ExtractSqsMessageAttributes(request)
 	queueName := GetQueueNameFromRequest(request)
-	queueEquals := func(s interface{}, v interface{}) bool {
-		src := s.(*Queue)
-		value := v.(*string)
-		return src.Name == *value
-	}
-	q := c.Queues.Get(&queueName, queueEquals)
-	if q == nil {
-		return nil, "XML", errors.New("QueueNotFound")
-	}
-	var messageAttrs []SqsMessageAttribute
-	for k := range messageAttributes {
-		messageAttrs = append(messageAttrs, messageAttributes[k])
-	}
-	message := NewMessage([]byte(messageBody), messageAttrs, "", md5OfMessageAttributes)
-	q.(*Queue).Messages.Put(message)
-	return NewSendMessageResponse(
+	queue := c.GetQueue(queueName)
+	if queue == nil {
+		return nil, "XML", ErrQueueDoesNotExist
+	}
+	message, err := c.NewMessageFromRequest(request, "")
+	if err != nil {
+		return nil, "XML", err
+	}
+	if message, err = queue.SendMessage(message); err != nil {
+		return nil, "XML", err
+	}
+	return NewSendMessageResponse(common.RequestId(request),
 		SendMessageResult{
 			MD5OfMessageAttributes: message.MD5OfMessageAttributes,
 			MD5OfMessageBody:       message.MD5OfMessageBody,
-			MessageId:              message.MessageId}), "XML", nil
+			MessageId:              message.MessageId,
+			SequenceNumber:         message.SequenceNumber}), "XML", nil
+}
+
+func (c *SQS) SendMessageBatch(request *http.Request) (interface{}, string, error) {
+	queueName := GetQueueNameFromRequest(request)
+	queue := c.GetQueue(queueName)
+	if queue == nil {
+		return nil, "XML", ErrQueueDoesNotExist
+	}
+	ids := []string{}
+	messages := make(map[string]*Message)
+	entryErrors := make(map[string]error)
+	batchSize := 0
+	for i := 1; true; i++ {
+		prefix := fmt.Sprintf("SendMessageBatchRequestEntry.%d.", i)
+		id := request.FormValue(prefix + "Id")
+		if id == "" {
+			break
+		}
+		if !IsValidBatchEntryId(id) {
+			return nil, "XML", ErrInvalidBatchEntryId
+		}
+		if _, ok := messages[id]; ok {
+			return nil, "XML", ErrBatchEntryIdsNotDistinct
+		}
+		ids = append(ids, id)
+		if len(ids) > 10 {
+			return nil, "XML", ErrTooManyEntriesInBatchRequest
+		}
+		message, err := c.NewMessageFromRequest(request, prefix)
+		if err != nil {
+			entryErrors[id] = err
+			continue
+		}
+		batchSize += MessageSize(string(message.MessageBody), message.MessageAttributes)
+		messages[id] = message
+	}
+	if len(ids) == 0 {
+		return nil, "XML", ErrEmptyBatchRequest
+	}
+	if batchSize > common.MaxMessageSize {
+		return nil, "XML", ErrBatchRequestTooLong
+	}
+	sentEntries := []SendMessageBatchResultEntry{}
+	failedEntries := []BatchResultErrorEntry{}
+	for _, id := range ids {
+		message, err := messages[id], entryErrors[id]
+		if err == nil {
+			message, err = queue.SendMessage(message)
+		}
+		if err == nil {
+			sentEntries = append(sentEntries, SendMessageBatchResultEntry{
+				Id:                     id,
+				MessageId:              message.MessageId,
+				MD5OfMessageAttributes: message.MD5OfMessageAttributes,
+				MD5OfMessageBody:       message.MD5OfMessageBody,
+				SequenceNumber:         message.SequenceNumber})
+		} else {
+			failedEntries = append(failedEntries, NewBatchResultErrorEntry(id, err))
+		}
+	}
+	return NewSendMessageBatchResponse(common.RequestId(request),
+		SendMessageBatchResult{
+			Entry: sentEntries,
+			Error: failedEntries}), "XML", nil
 }
 
 func (c *SQS) SetQueueAttributes(request *http.Request) (interface{}, string, error) {
-	return NewSetQueueAttributesResponse(), "XML", nil
+	queueName := GetQueueNameFromRequest(request)
+	queue := c.GetQueue(queueName)
+	if queue == nil {
+		return nil, "XML", ErrQueueDoesNotExist
+	}
+	if err := queue.SetAttributes(ExtractQueueAttributes(request)); err != nil {
+		return nil, "XML", err
+	}
+	return NewSetQueueAttributesResponse(common.RequestId(request)), "XML", nil
+}
+
+/*** Change Message Visibility Response */
+type ChangeMessageVisibilityResponse struct {
+	Xmlns    string                  `xml:"xmlns,attr,omitempty"`
+	Metadata common.ResponseMetadata `xml:"ResponseMetadata,omitempty"`
+}
+
+func NewChangeMessageVisibilityResponse(requestId string) *ChangeMessageVisibilityResponse {
+	return &ChangeMessageVisibilityResponse{
+		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
+		Metadata: common.ResponseMetadata{RequestId: requestId}}
+}
+
+/*** Change Message Visibility Batch Response */
+type ChangeMessageVisibilityBatchResultEntry struct {
+	Id string `xml:"Id"`
+}
+
+type ChangeMessageVisibilityBatchResult struct {
+	Entry []ChangeMessageVisibilityBatchResultEntry `xml:"ChangeMessageVisibilityBatchResultEntry"`
+	Error []BatchResultErrorEntry                   `xml:"BatchResultErrorEntry,omitempty"`
+}
+
+type ChangeMessageVisibilityBatchResponse struct {
+	Xmlns    string                             `xml:"xmlns,attr,omitempty"`
+	Result   ChangeMessageVisibilityBatchResult `xml:"ChangeMessageVisibilityBatchResult"`
+	Metadata common.ResponseMetadata            `xml:"ResponseMetadata,omitempty"`
+}
+
+func NewChangeMessageVisibilityBatchResponse(requestId string, Result ChangeMessageVisibilityBatchResult) *ChangeMessageVisibilityBatchResponse {
+	return &ChangeMessageVisibilityBatchResponse{
+		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
+		Metadata: common.ResponseMetadata{RequestId: requestId},
+		Result:   Result}
 }
 
 type DeleteEntry struct {
@@ -239,7 +426,7 @@ type DeleteEntry struct {
 
 /*** List Queues Response */
 type ListQueuesResult struct {
-	QueueUrl []string `xml:"QueueUrl"`
+	QueueUrl []string `xml:"QueueUrl" json:"QueueUrls"`
 }
 
 type ListQueuesResponse struct {
@@ -248,10 +435,28 @@ type ListQueuesResponse struct {
 	Metadata common.ResponseMetadata `xml:"ResponseMetadata"`
 }
 
-func NewListQueuesResponse(Result ListQueuesResult) *ListQueuesResponse {
+func NewListQueuesResponse(requestId string, Result ListQueuesResult) *ListQueuesResponse {
 	return &ListQueuesResponse{
 		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
-		Metadata: common.ResponseMetadata{RequestId: "00000000-0000-0000-0000-000000000000"},
+		Metadata: common.ResponseMetadata{RequestId: requestId},
+		Result:   Result}
+}
+
+/*** List Dead Letter Source Queues Response */
+type ListDeadLetterSourceQueuesResult struct {
+	QueueUrl []string `xml:"QueueUrl" json:"queueUrls"`
+}
+
+type ListDeadLetterSourceQueuesResponse struct {
+	Xmlns    string                           `xml:"xmlns,attr"`
+	Result   ListDeadLetterSourceQueuesResult `xml:"ListDeadLetterSourceQueuesResult"`
+	Metadata common.ResponseMetadata          `xml:"ResponseMetadata"`
+}
+
+func NewListDeadLetterSourceQueuesResponse(requestId string, Result ListDeadLetterSourceQueuesResult) *ListDeadLetterSourceQueuesResponse {
+	return &ListDeadLetterSourceQueuesResponse{
+		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
+		Metadata: common.ResponseMetadata{RequestId: requestId},
 		Result:   Result}
 }
 
@@ -266,19 +471,20 @@ type CreateQueueResponse struct {
 	Metadata common.ResponseMetadata `xml:"ResponseMetadata"`
 }
 
-func NewCreateQueueResponse(Result CreateQueueResult) *CreateQueueResponse {
+func NewCreateQueueResponse(requestId string, Result CreateQueueResult) *CreateQueueResponse {
 	return &CreateQueueResponse{
 		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
-		Metadata: common.ResponseMetadata{RequestId: "00000000-0000-0000-0000-000000000000"},
+		Metadata: common.ResponseMetadata{RequestId: requestId},
 		Result:   Result}
 }
 
 /*** Send Message Response */
 
 type SendMessageResult struct {
-	MD5OfMessageAttributes string `xml:"MD5OfMessageAttributes"`
+	MD5OfMessageAttributes string `xml:"MD5OfMessageAttributes" json:"MD5OfMessageAttributes,omitempty"`
 	MD5OfMessageBody       string `xml:"MD5OfMessageBody"`
 	MessageId              string `xml:"MessageId"`
+	SequenceNumber         string `xml:"SequenceNumber,omitempty" json:"SequenceNumber,omitempty"`
 }
 
 type SendMessageResponse struct {
@@ -287,16 +493,43 @@ type SendMessageResponse struct {
 	Metadata common.ResponseMetadata `xml:"ResponseMetadata"`
 }
 
-func NewSendMessageResponse(Result SendMessageResult) *SendMessageResponse {
+func NewSendMessageResponse(requestId string, Result SendMessageResult) *SendMessageResponse {
 	return &SendMessageResponse{
 		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
-		Metadata: common.ResponseMetadata{RequestId: "00000000-0000-0000-0000-000000000000"},
+		Metadata: common.ResponseMetadata{RequestId: requestId},
+		Result:   Result}
+}
+
+/*** Send Message Batch Response */
+type SendMessageBatchResultEntry struct {
+	Id                     string `xml:"Id"`
+	MessageId              string `xml:"MessageId"`
+	MD5OfMessageAttributes string `xml:"MD5OfMessageAttributes,omitempty" json:"MD5OfMessageAttributes,omitempty"`
+	MD5OfMessageBody       string `xml:"MD5OfMessageBody"`
+	SequenceNumber         string `xml:"SequenceNumber,omitempty" json:"SequenceNumber,omitempty"`
+}
+
+type SendMessageBatchResult struct {
+	Entry []SendMessageBatchResultEntry `xml:"SendMessageBatchResultEntry"`
+	Error []BatchResultErrorEntry       `xml:"BatchResultErrorEntry,omitempty"`
+}
+
+type SendMessageBatchResponse struct {
+	Xmlns    string                  `xml:"xmlns,attr"`
+	Result   SendMessageBatchResult  `xml:"SendMessageBatchResult"`
+	Metadata common.ResponseMetadata `xml:"ResponseMetadata"`
+}
+
+func NewSendMessageBatchResponse(requestId string, Result SendMessageBatchResult) *SendMessageBatchResponse {
+	return &SendMessageBatchResponse{
+		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
+		Metadata: common.ResponseMetadata{RequestId: requestId},
 		Result:   Result}
 }
 
 /*** Receive Message Response */
 type ReceiveMessageResult struct {
-	Message []*Message `xml:"Message,omitempty"`
+	Message []*Message `xml:"Message,omitempty" json:"Messages,omitempty"`
 }
 
 type ReceiveMessageResponse struct {
@@ -305,10 +538,10 @@ type ReceiveMessageResponse struct {
 	Metadata common.ResponseMetadata `xml:"ResponseMetadata"`
 }
 
-func NewReceiveMessageResponse(Result ReceiveMessageResult) *ReceiveMessageResponse {
+func NewReceiveMessageResponse(requestId string, Result ReceiveMessageResult) *ReceiveMessageResponse {
 	return &ReceiveMessageResponse{
 		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
-		Metadata: common.ResponseMetadata{RequestId: "00000000-0000-0000-0000-000000000000"},
+		Metadata: common.ResponseMetadata{RequestId: requestId},
 		Result:   Result}
 }
 
@@ -323,16 +556,16 @@ type DeleteQueueResponse struct {
 	Metadata common.ResponseMetadata `xml:"ResponseMetadata,omitempty"`
 }
 
-func NewDeleteQueueResponse() *DeleteQueueResponse {
+func NewDeleteQueueResponse(requestId string) *DeleteQueueResponse {
 	return &DeleteQueueResponse{
 		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
-		Metadata: common.ResponseMetadata{RequestId: "00000000-0000-0000-0000-000000000000"}}
+		Metadata: common.ResponseMetadata{RequestId: requestId}}
 }
 
-func NewDeleteMessageResponse() *DeleteMessageResponse {
+func NewDeleteMessageResponse(requestId string) *DeleteMessageResponse {
 	return &DeleteMessageResponse{
 		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
-		Metadata: common.ResponseMetadata{RequestId: "00000000-0000-0000-0000-000000000000"}}
+		Metadata: common.ResponseMetadata{RequestId: requestId}}
 }
 
 type DeleteMessageBatchResultEntry struct {
@@ -342,10 +575,20 @@ type DeleteMessageBatchResultEntry struct {
 type BatchResultErrorEntry struct {
 	Code        string `xml:"Code"`
 	Id          string `xml:"Id"`
-	Message     string `xml:"Message,omitempty"`
+	Message     string `xml:"Message,omitempty" json:"Message,omitempty"`
 	SenderFault bool   `xml:"SenderFault"`
 }
 
+// NewBatchResultErrorEntry reports the error of a single batch entry
+func NewBatchResultErrorEntry(id string, err error) BatchResultErrorEntry {
+	e := common.ToErrorType(err)
+	return BatchResultErrorEntry{
+		Code:        e.Code,
+		Id:          id,
+		Message:     e.Message,
+		SenderFault: e.SenderFault()}
+}
+
 type DeleteMessageBatchResult struct {
 	Entry []DeleteMessageBatchResultEntry `xml:"DeleteMessageBatchResultEntry"`
 	Error []BatchResultErrorEntry         `xml:"BatchResultErrorEntry,omitempty"`
@@ -358,10 +601,10 @@ type DeleteMessageBatchResponse struct {
 	Metadata common.ResponseMetadata  `xml:"ResponseMetadata,omitempty"`
 }
 
-func NewDeleteMessageBatchResponse(Result DeleteMessageBatchResult) *DeleteMessageBatchResponse {
+func NewDeleteMessageBatchResponse(requestId string, Result DeleteMessageBatchResult) *DeleteMessageBatchResponse {
 	return &DeleteMessageBatchResponse{
 		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
-		Metadata: common.ResponseMetadata{RequestId: "00000000-0000-0000-0000-000000000000"},
+		Metadata: common.ResponseMetadata{RequestId: requestId},
 		Result:   Result}
 }
 
@@ -371,15 +614,15 @@ type PurgeQueueResponse struct {
 	Metadata common.ResponseMetadata `xml:"ResponseMetadata,omitempty"`
 }
 
-func NewPurgeQueueResponse() *PurgeQueueResponse {
+func NewPurgeQueueResponse(requestId string) *PurgeQueueResponse {
 	return &PurgeQueueResponse{
 		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
-		Metadata: common.ResponseMetadata{RequestId: "00000000-0000-0000-0000-000000000000"}}
+		Metadata: common.ResponseMetadata{RequestId: requestId}}
 }
 
 /*** Get Queue Url Response */
 type GetQueueUrlResult struct {
-	QueueUrl string `xml:"QueueUrl,omitempty"`
+	QueueUrl string `xml:"QueueUrl,omitempty" json:"QueueUrl,omitempty"`
 }
 
 type GetQueueUrlResponse struct {
@@ -388,10 +631,10 @@ type GetQueueUrlResponse struct {
 	Metadata common.ResponseMetadata `xml:"ResponseMetadata,omitempty"`
 }
 
-func NewGetQueueUrlResponse(Result GetQueueUrlResult) *GetQueueUrlResponse {
+func NewGetQueueUrlResponse(requestId string, Result GetQueueUrlResult) *GetQueueUrlResponse {
 	return &GetQueueUrlResponse{
 		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
-		Metadata: common.ResponseMetadata{RequestId: "00000000-0000-0000-0000-000000000000"},
+		Metadata: common.ResponseMetadata{RequestId: requestId},
 		Result:   Result}
 }
 
@@ -402,8 +645,7 @@ type Attribute struct {
 }
 
 type GetQueueAttributesResult struct {
-	/* VisibilityTimeout, DelaySeconds, ReceiveMessageWaitTimeSeconds, ApproximateNumberOfMessages
-	   ApproximateNumberOfMessagesNotVisible, CreatedTimestamp, LastModifiedTimestamp, QueueArn */
+	/* See queueAttributeNames in attributes.go */
 	Attrs []Attribute `xml:"Attribute,omitempty"`
 }
 
@@ -413,10 +655,10 @@ type GetQueueAttributesResponse struct {
 	Metadata common.ResponseMetadata  `xml:"ResponseMetadata,omitempty"`
 }
 
-func NewGetQueueAttributesResponse(Result GetQueueAttributesResult) *GetQueueAttributesResponse {
+func NewGetQueueAttributesResponse(requestId string, Result GetQueueAttributesResult) *GetQueueAttributesResponse {
 	return &GetQueueAttributesResponse{
 		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
-		Metadata: common.ResponseMetadata{RequestId: "00000000-0000-0000-0000-000000000000"},
+		Metadata: common.ResponseMetadata{RequestId: requestId},
 		Result:   Result}
 }
 
@@ -425,10 +667,10 @@ type SetQueueAttributesResponse struct {
 	Metadata common.ResponseMetadata `xml:"ResponseMetadata,omitempty"`
 }
 
-func NewSetQueueAttributesResponse() *SetQueueAttributesResponse {
+func NewSetQueueAttributesResponse(requestId string) *SetQueueAttributesResponse {
 	return &SetQueueAttributesResponse{
 		Xmlns:    "http://queue.amazonaws.com/doc/2012-11-05/",
-		Metadata: common.ResponseMetadata{RequestId: "00000000-0000-0000-0000-000000000000"}}
+		Metadata: common.ResponseMetadata{RequestId: requestId}}
 }
 
 /*** Get Message Attributes ***/
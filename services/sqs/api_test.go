@@ -0,0 +1,768 @@
+package sqs
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Tweddle-SE-Team/goaws/services/common"
+)
+
+func newFormRequest(t *testing.T, form url.Values) *http.Request {
+	req, err := http.NewRequest("POST", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.PostForm = form
+	return req
+}
+
+func newTestSQS(queueName string) (*SQS, *Queue) {
+	service := NewSQS()
+	queue := NewQueue(queueName, "localhost:4100")
+	service.Queues.Put(queue)
+	return service, queue
+}
+
+func receive(t *testing.T, service *SQS, form url.Values) []*Message {
+	output, _, err := service.ReceiveMessage(newFormRequest(t, form))
+	if err != nil {
+		t.Fatalf("ReceiveMessage returned error: %v", err)
+	}
+	return output.(*ReceiveMessageResponse).Result.Message
+}
+
+func TestReceiveMessage_VisibilityTimeout(t *testing.T) {
+	service, queue := newTestSQS("visibility-queue")
+	queue.Messages.Put(NewMessage([]byte("hello"), nil, "", ""))
+
+	form := url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	form.Set("VisibilityTimeout", "1")
+	messages := receive(t, service, form)
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	firstReceipt := messages[0].ReceiptHandle
+
+	if messages := receive(t, service, form); len(messages) != 0 {
+		t.Errorf("message should be invisible, got %d messages", len(messages))
+	}
+	if size := queue.InFlightSize(); size != 1 {
+		t.Errorf("expected 1 in-flight message, got %d", size)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	messages = receive(t, service, form)
+	if len(messages) != 1 {
+		t.Fatalf("expected message to be redelivered, got %d messages", len(messages))
+	}
+	if messages[0].ReceiptHandle == firstReceipt {
+		t.Errorf("redelivered message should have a new receipt handle")
+	}
+	if queue.DeleteMessage(firstReceipt) {
+		t.Errorf("stale receipt handle should not delete the message")
+	}
+	if !queue.DeleteMessage(messages[0].ReceiptHandle) {
+		t.Errorf("current receipt handle should delete the message")
+	}
+	if size := queue.InFlightSize(); size != 0 {
+		t.Errorf("expected no in-flight messages, got %d", size)
+	}
+}
+
+func TestChangeMessageVisibilityBatch(t *testing.T) {
+	service, queue := newTestSQS("change-visibility-queue")
+	queue.Messages.Put(NewMessage([]byte("hello"), nil, "", ""))
+
+	form := url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	messages := receive(t, service, form)
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+
+	form.Set("ChangeMessageVisibilityBatchRequestEntry.1.Id", "valid")
+	form.Set("ChangeMessageVisibilityBatchRequestEntry.1.ReceiptHandle", messages[0].ReceiptHandle)
+	form.Set("ChangeMessageVisibilityBatchRequestEntry.1.VisibilityTimeout", "0")
+	form.Set("ChangeMessageVisibilityBatchRequestEntry.2.Id", "unknown")
+	form.Set("ChangeMessageVisibilityBatchRequestEntry.2.ReceiptHandle", "does-not-exist")
+	form.Set("ChangeMessageVisibilityBatchRequestEntry.2.VisibilityTimeout", "10")
+	output, _, err := service.ChangeMessageVisibilityBatch(newFormRequest(t, form))
+	if err != nil {
+		t.Fatalf("ChangeMessageVisibilityBatch returned error: %v", err)
+	}
+	result := output.(*ChangeMessageVisibilityBatchResponse).Result
+	if len(result.Entry) != 1 || result.Entry[0].Id != "valid" {
+		t.Errorf("unexpected successful entries: %+v", result.Entry)
+	}
+	if len(result.Error) != 1 || result.Error[0].Id != "unknown" || result.Error[0].Code != "ReceiptHandleIsInvalid" {
+		t.Errorf("unexpected failed entries: %+v", result.Error)
+	}
+	if size := queue.Messages.Size(); size != 1 {
+		t.Errorf("message should be visible again, queue size is %d", size)
+	}
+}
+
+func TestChangeMessageVisibilityBatch_InvalidBatch(t *testing.T) {
+	service, queue := newTestSQS("invalid-change-visibility-queue")
+	queue.Messages.Put(NewMessage([]byte("hello"), nil, "", ""))
+
+	form := url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	messages := receive(t, service, form)
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+
+	form.Set("ChangeMessageVisibilityBatchRequestEntry.1.Id", "same")
+	form.Set("ChangeMessageVisibilityBatchRequestEntry.1.ReceiptHandle", messages[0].ReceiptHandle)
+	form.Set("ChangeMessageVisibilityBatchRequestEntry.1.VisibilityTimeout", "0")
+	form.Set("ChangeMessageVisibilityBatchRequestEntry.2.Id", "same")
+	form.Set("ChangeMessageVisibilityBatchRequestEntry.2.ReceiptHandle", messages[0].ReceiptHandle)
+	form.Set("ChangeMessageVisibilityBatchRequestEntry.2.VisibilityTimeout", "0")
+	if _, _, err := service.ChangeMessageVisibilityBatch(newFormRequest(t, form)); err != ErrBatchEntryIdsNotDistinct {
+		t.Errorf("expected BatchEntryIdsNotDistinct, got %v", err)
+	}
+	form.Set("ChangeMessageVisibilityBatchRequestEntry.2.Id", "not valid!")
+	if _, _, err := service.ChangeMessageVisibilityBatch(newFormRequest(t, form)); err != ErrInvalidBatchEntryId {
+		t.Errorf("expected InvalidBatchEntryId, got %v", err)
+	}
+	if queue.InFlightSize() != 1 || queue.Messages.Size() != 0 {
+		t.Errorf("a rejected batch must not change any visibility, %d in flight and %d visible", queue.InFlightSize(), queue.Messages.Size())
+	}
+}
+
+func TestSendMessageBatch(t *testing.T) {
+	service, queue := newTestSQS("send-batch-queue")
+
+	form := url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	form.Set("SendMessageBatchRequestEntry.1.Id", "first")
+	form.Set("SendMessageBatchRequestEntry.1.MessageBody", "hello world")
+	form.Set("SendMessageBatchRequestEntry.1.MessageAttribute.1.Name", "some_string")
+	form.Set("SendMessageBatchRequestEntry.1.MessageAttribute.1.Value.DataType", "String")
+	form.Set("SendMessageBatchRequestEntry.1.MessageAttribute.1.Value.StringValue", "string value with a special character ⌘")
+	form.Set("SendMessageBatchRequestEntry.1.MessageAttribute.2.Name", "some_number")
+	form.Set("SendMessageBatchRequestEntry.1.MessageAttribute.2.Value.DataType", "Number")
+	form.Set("SendMessageBatchRequestEntry.1.MessageAttribute.2.Value.StringValue", "123")
+	form.Set("SendMessageBatchRequestEntry.1.MessageAttribute.3.Name", "some_binary")
+	form.Set("SendMessageBatchRequestEntry.1.MessageAttribute.3.Value.DataType", "Binary")
+	form.Set("SendMessageBatchRequestEntry.1.MessageAttribute.3.Value.BinaryValue", "AQID")
+	form.Set("SendMessageBatchRequestEntry.2.Id", "second")
+	form.Set("SendMessageBatchRequestEntry.2.MessageBody", "second message")
+	output, _, err := service.SendMessageBatch(newFormRequest(t, form))
+	if err != nil {
+		t.Fatalf("SendMessageBatch returned error: %v", err)
+	}
+	result := output.(*SendMessageBatchResponse).Result
+	if len(result.Entry) != 2 || len(result.Error) != 0 {
+		t.Fatalf("expected 2 successful entries, got %+v", result)
+	}
+	if result.Entry[0].MD5OfMessageBody != "5eb63bbbe01eeed093cb22bb8f5acdc3" {
+		t.Errorf("unexpected body MD5 %s", result.Entry[0].MD5OfMessageBody)
+	}
+	if result.Entry[0].MD5OfMessageAttributes != "5e7cf12121831a527e7e6b04c562fbac" {
+		t.Errorf("unexpected attributes MD5 %s", result.Entry[0].MD5OfMessageAttributes)
+	}
+	if size := queue.Messages.Size(); size != 2 {
+		t.Errorf("expected 2 messages in queue, got %d", size)
+	}
+
+	for i := 3; i <= 11; i++ {
+		form.Set(fmt.Sprintf("SendMessageBatchRequestEntry.%d.Id", i), fmt.Sprintf("entry-%d", i))
+		form.Set(fmt.Sprintf("SendMessageBatchRequestEntry.%d.MessageBody", i), "body")
+	}
+	if _, _, err := service.SendMessageBatch(newFormRequest(t, form)); err != ErrTooManyEntriesInBatchRequest {
+		t.Errorf("expected TooManyEntriesInBatchRequest, got %v", err)
+	}
+}
+
+func TestReceiveMessage_LongPolling(t *testing.T) {
+	service, queue := newTestSQS("long-polling-queue")
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		queue.Messages.Put(NewMessage([]byte("hello"), nil, "", ""))
+	}()
+
+	form := url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	form.Set("WaitTimeSeconds", "5")
+	start := time.Now()
+	messages := receive(t, service, form)
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("receive should return as soon as a message arrives, took %v", elapsed)
+	}
+
+	form.Set("WaitTimeSeconds", "1")
+	start = time.Now()
+	if messages := receive(t, service, form); len(messages) != 0 {
+		t.Errorf("expected no messages, got %d", len(messages))
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("receive should wait for the wait time on an empty queue, took %v", elapsed)
+	}
+}
+
+func TestSetAndGetQueueAttributes(t *testing.T) {
+	service := NewSQS()
+	form := url.Values{}
+	form.Set("QueueName", "attributes-queue")
+	form.Set("Attribute.1.Name", "DelaySeconds")
+	form.Set("Attribute.1.Value", "5")
+	if _, _, err := service.CreateQueue(newFormRequest(t, form)); err != nil {
+		t.Fatalf("CreateQueue returned error: %v", err)
+	}
+	queue := service.GetQueue("attributes-queue")
+	if queue == nil || queue.DelaySecs != 5 {
+		t.Fatalf("queue should be created with its attributes, got %+v", queue)
+	}
+
+	form = url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	form.Set("Attribute.1.Name", "VisibilityTimeout")
+	form.Set("Attribute.1.Value", "60")
+	if _, _, err := service.SetQueueAttributes(newFormRequest(t, form)); err != nil {
+		t.Fatalf("SetQueueAttributes returned error: %v", err)
+	}
+	form.Set("Attribute.1.Value", "43201")
+	if _, _, err := service.SetQueueAttributes(newFormRequest(t, form)); err != ErrInvalidAttributeValue {
+		t.Errorf("expected InvalidAttributeValue, got %v", err)
+	}
+
+	form = url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	form.Set("AttributeName.1", "VisibilityTimeout")
+	form.Set("AttributeName.2", "DelaySeconds")
+	output, _, err := service.GetQueueAttributes(newFormRequest(t, form))
+	if err != nil {
+		t.Fatalf("GetQueueAttributes returned error: %v", err)
+	}
+	attributes := output.(*GetQueueAttributesResponse).Result.Attrs
+	expected := []Attribute{{Name: "DelaySeconds", Value: "5"}, {Name: "VisibilityTimeout", Value: "60"}}
+	if len(attributes) != len(expected) || attributes[0] != expected[0] || attributes[1] != expected[1] {
+		t.Errorf("expected %+v, got %+v", expected, attributes)
+	}
+
+	form.Set("AttributeName.3", "NotAnAttribute")
+	if _, _, err := service.GetQueueAttributes(newFormRequest(t, form)); err != ErrInvalidAttributeName {
+		t.Errorf("expected InvalidAttributeName, got %v", err)
+	}
+
+	form = url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	output, _, err = service.GetQueueAttributes(newFormRequest(t, form))
+	if err != nil {
+		t.Fatalf("GetQueueAttributes returned error: %v", err)
+	}
+	if attributes := output.(*GetQueueAttributesResponse).Result.Attrs; len(attributes) != 0 {
+		t.Errorf("expected no attributes unless requested, got %+v", attributes)
+	}
+	form.Set("AttributeName.1", "All")
+	output, _, err = service.GetQueueAttributes(newFormRequest(t, form))
+	if err != nil {
+		t.Fatalf("GetQueueAttributes returned error: %v", err)
+	}
+	if attributes := output.(*GetQueueAttributesResponse).Result.Attrs; len(attributes) < len(expected) {
+		t.Errorf("expected every attribute for All, got %+v", attributes)
+	}
+}
+
+// Run with -race: attributes set concurrently with sends and receives must be read under the queue lock
+func TestSetQueueAttributes_ConcurrentSendReceive(t *testing.T) {
+	service, queue := newTestSQS("concurrent-attributes-queue")
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			queue.SetAttributes(map[string]string{"VisibilityTimeout": "1", "ReceiveMessageWaitTimeSeconds": "0", "MaximumMessageSize": "2048"})
+		}
+	}()
+	form := url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	for i := 0; i < 100; i++ {
+		if _, err := queue.SendMessage(NewMessage([]byte("hello"), nil, "", "")); err != nil {
+			t.Fatal(err)
+		}
+		receive(t, service, form)
+	}
+	close(stop)
+	<-done
+}
+
+func TestReceiveMessage_RedrivePolicy(t *testing.T) {
+	service, queue := newTestSQS("redrive-source-queue")
+	deadLetterQueue := NewQueue("redrive-dead-letter-queue", "localhost:4100")
+	service.Queues.Put(deadLetterQueue)
+	err := queue.SetAttributes(map[string]string{
+		"RedrivePolicy": `{"deadLetterTargetArn":"` + deadLetterQueue.Arn + `","maxReceiveCount":"1"}`})
+	if err != nil {
+		t.Fatalf("SetAttributes returned error: %v", err)
+	}
+	queue.Messages.Put(NewMessage([]byte("poison"), nil, "", ""))
+
+	form := url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	messages := receive(t, service, form)
+	if len(messages) != 1 || messages[0].ApproximateReceiveCount != 1 {
+		t.Fatalf("expected 1 message received once, got %+v", messages)
+	}
+	if err := queue.ChangeVisibilityTimeout(messages[0].ReceiptHandle, 0); err != nil {
+		t.Fatalf("ChangeVisibilityTimeout returned error: %v", err)
+	}
+
+	if messages := receive(t, service, form); len(messages) != 0 {
+		t.Errorf("message exceeding maxReceiveCount should not be delivered, got %d", len(messages))
+	}
+	if size := deadLetterQueue.Messages.Size(); size != 1 {
+		t.Errorf("expected message in dead-letter queue, got %d", size)
+	}
+
+	form = url.Values{}
+	form.Set("QueueUrl", deadLetterQueue.URL)
+	output, _, err := service.ListDeadLetterSourceQueues(newFormRequest(t, form))
+	if err != nil {
+		t.Fatalf("ListDeadLetterSourceQueues returned error: %v", err)
+	}
+	queueUrls := output.(*ListDeadLetterSourceQueuesResponse).Result.QueueUrl
+	if len(queueUrls) != 1 || queueUrls[0] != queue.URL {
+		t.Errorf("expected [%s], got %v", queue.URL, queueUrls)
+	}
+}
+
+func TestFifoQueue(t *testing.T) {
+	service := NewSQS()
+	form := url.Values{}
+	form.Set("QueueName", "orders.fifo")
+	if _, _, err := service.CreateQueue(newFormRequest(t, form)); err != ErrInvalidFifoQueueName {
+		t.Errorf("expected InvalidFifoQueueName, got %v", err)
+	}
+	form.Set("Attribute.1.Name", "FifoQueue")
+	form.Set("Attribute.1.Value", "true")
+	form.Set("Attribute.2.Name", "ContentBasedDeduplication")
+	form.Set("Attribute.2.Value", "true")
+	if _, _, err := service.CreateQueue(newFormRequest(t, form)); err != nil {
+		t.Fatalf("CreateQueue returned error: %v", err)
+	}
+	queue := service.GetQueue("orders.fifo")
+
+	send := func(body string, groupId string) *SendMessageResult {
+		form := url.Values{}
+		form.Set("QueueUrl", queue.URL)
+		form.Set("MessageBody", body)
+		form.Set("MessageGroupId", groupId)
+		output, _, err := service.SendMessage(newFormRequest(t, form))
+		if err != nil {
+			t.Fatalf("SendMessage returned error: %v", err)
+		}
+		return &output.(*SendMessageResponse).Result
+	}
+	first := send("a1", "a")
+	send("a2", "a")
+	send("b1", "b")
+	if duplicate := send("a1", "a"); duplicate.MessageId != first.MessageId || duplicate.SequenceNumber != first.SequenceNumber {
+		t.Errorf("duplicate message should return the original result, got %+v want %+v", duplicate, first)
+	}
+	if size := queue.Messages.Size(); size != 3 {
+		t.Errorf("duplicate message should not be enqueued, queue size is %d", size)
+	}
+
+	form = url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	messages := receive(t, service, form)
+	if len(messages) != 1 || string(messages[0].MessageBody) != "a1" {
+		t.Fatalf("expected a1 first, got %+v", messages)
+	}
+	inFlight := messages[0].ReceiptHandle
+	form.Set("MaxNumberOfMessages", "10")
+	messages = receive(t, service, form)
+	if len(messages) != 1 || string(messages[0].MessageBody) != "b1" {
+		t.Fatalf("group a is in flight, expected only b1, got %+v", messages)
+	}
+	if err := queue.ChangeVisibilityTimeout(inFlight, 0); err != nil {
+		t.Fatalf("ChangeVisibilityTimeout returned error: %v", err)
+	}
+	messages = receive(t, service, form)
+	if len(messages) != 2 || string(messages[0].MessageBody) != "a1" || string(messages[1].MessageBody) != "a2" {
+		t.Errorf("returned message should keep its place in its group, got %+v", messages)
+	}
+}
+
+func TestFifoQueue_ConcurrentSends(t *testing.T) {
+	queue := NewQueue("concurrent.fifo", "localhost:4100")
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				message := NewMessage([]byte(fmt.Sprintf("%d-%d", w, i)), nil, "", "")
+				message.MessageGroupId = "group"
+				message.MessageDeduplicationId = fmt.Sprintf("%d-%d", w, i)
+				if _, err := queue.SendMessage(message); err != nil {
+					t.Error(err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	previous := ""
+	for _, message := range queue.Peek() {
+		if message.SequenceNumber <= previous {
+			t.Fatalf("message %s was queued after %s", message.SequenceNumber, previous)
+		}
+		previous = message.SequenceNumber
+	}
+	if size := queue.Messages.Size(); size != 400 {
+		t.Errorf("expected 400 messages, got %d", size)
+	}
+}
+
+func TestSendMessage_DelaySeconds(t *testing.T) {
+	service, queue := newTestSQS("delay-queue")
+
+	form := url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	form.Set("MessageBody", "later")
+	form.Set("DelaySeconds", "901")
+	if _, _, err := service.SendMessage(newFormRequest(t, form)); err != ErrInvalidDelaySeconds {
+		t.Errorf("expected InvalidDelaySeconds, got %v", err)
+	}
+	form.Set("DelaySeconds", "1")
+	if _, _, err := service.SendMessage(newFormRequest(t, form)); err != nil {
+		t.Fatalf("SendMessage returned error: %v", err)
+	}
+	if size := queue.DelayedSize(); size != 1 {
+		t.Errorf("expected 1 delayed message, got %d", size)
+	}
+
+	form = url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	if messages := receive(t, service, form); len(messages) != 0 {
+		t.Errorf("delayed message should not be received, got %d", len(messages))
+	}
+	form.Set("WaitTimeSeconds", "3")
+	if messages := receive(t, service, form); len(messages) != 1 {
+		t.Errorf("expected the message once its delay expired, got %d", len(messages))
+	}
+	if size := queue.DelayedSize(); size != 0 {
+		t.Errorf("expected no delayed messages, got %d", size)
+	}
+}
+
+func TestSendMessage_DelaySecondsFifo(t *testing.T) {
+	service, queue := newTestSQS("delay.fifo")
+	queue.SetAttributes(map[string]string{"ContentBasedDeduplication": "true"})
+
+	form := url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	form.Set("MessageBody", "now")
+	form.Set("MessageGroupId", "group")
+	form.Set("DelaySeconds", "0")
+	if _, _, err := service.SendMessage(newFormRequest(t, form)); err != nil {
+		t.Errorf("expected a delay of 0 to be accepted, got %v", err)
+	}
+	form.Set("MessageBody", "later")
+	form.Set("DelaySeconds", "1")
+	if _, _, err := service.SendMessage(newFormRequest(t, form)); err != ErrInvalidParameterForQueueType {
+		t.Errorf("expected InvalidParameterValue for a per-message delay, got %v", err)
+	}
+	if size := queue.Messages.Size(); size != 1 {
+		t.Errorf("expected 1 visible message, got %d", size)
+	}
+}
+
+func TestQueue_ExpireMessages(t *testing.T) {
+	service, queue := newTestSQS("retention-queue")
+	if err := queue.SetAttributes(map[string]string{"MessageRetentionPeriod": "60"}); err != nil {
+		t.Fatalf("SetAttributes returned error: %v", err)
+	}
+	stale := NewMessage([]byte("stale"), nil, "", "")
+	stale.SentTime = time.Now().Add(-2 * time.Minute)
+	queue.Messages.Put(stale)
+	queue.Messages.Put(NewMessage([]byte("fresh"), nil, "", ""))
+
+	if expired := queue.ExpireMessages(time.Now()); expired != 1 {
+		t.Errorf("expected 1 expired message, got %d", expired)
+	}
+	if size := queue.Messages.Size(); size != 1 {
+		t.Errorf("expected 1 message left, got %d", size)
+	}
+
+	output, content, err := service.QueueStatistics(newFormRequest(t, url.Values{}))
+	if err != nil || content != "JSON" {
+		t.Fatalf("QueueStatistics returned %v, %v", content, err)
+	}
+	statistics := output.(*QueueStatisticsResponse).Queues
+	if len(statistics) != 1 || statistics[0].ExpiredMessages != 1 {
+		t.Errorf("expected expired message to be counted, got %+v", statistics)
+	}
+}
+
+func TestReceiveMessage_Attributes(t *testing.T) {
+	service, queue := newTestSQS("attributes-filter-queue")
+	form := url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	form.Set("MessageBody", "hello")
+	form.Set("MessageAttribute.1.Name", "trace.id")
+	form.Set("MessageAttribute.1.Value.DataType", "String")
+	form.Set("MessageAttribute.1.Value.StringValue", "abc")
+	form.Set("MessageAttribute.2.Name", "other")
+	form.Set("MessageAttribute.2.Value.DataType", "Number")
+	form.Set("MessageAttribute.2.Value.StringValue", "1")
+	if _, _, err := service.SendMessage(newFormRequest(t, form)); err != nil {
+		t.Fatalf("SendMessage returned error: %v", err)
+	}
+
+	form = url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	form.Set("AttributeName.1", "SentTimestamp")
+	form.Set("AttributeName.2", "ApproximateReceiveCount")
+	form.Set("MessageAttributeName.1", "trace.*")
+	messages := receive(t, service, form)
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	attributes := map[string]string{}
+	for _, attribute := range messages[0].Attributes {
+		attributes[attribute.Name] = attribute.Value
+	}
+	if len(attributes) != 2 || attributes["ApproximateReceiveCount"] != "1" || attributes["SentTimestamp"] == "" {
+		t.Errorf("unexpected system attributes %+v", messages[0].Attributes)
+	}
+	if len(messages[0].MessageAttributes) != 1 || messages[0].MessageAttributes[0].Name != "trace.id" {
+		t.Errorf("expected only trace.id message attribute, got %+v", messages[0].MessageAttributes)
+	}
+	expectedMD5 := service.HashAttributes(map[string]SqsMessageAttribute{"trace.id": messages[0].MessageAttributes[0]})
+	if messages[0].MD5OfMessageAttributes != expectedMD5 {
+		t.Errorf("MD5 should cover the returned attributes only")
+	}
+	if messages[0].visibilityTimer != nil || messages[0].ReceiptHandle == "" {
+		t.Errorf("expected a view of the message with its receipt handle only, got %+v", messages[0])
+	}
+}
+
+func TestReceiveMessage_ExpiringVisibility(t *testing.T) {
+	service, queue := newTestSQS("expiring-visibility-queue")
+	queue.Messages.Put(NewMessage([]byte("hello"), nil, "", ""))
+	form := url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	form.Set("VisibilityTimeout", "0")
+	form.Set("AttributeName.1", "All")
+	// The visibility timer returns the message while its view is built
+	for i := 0; i < 50; i++ {
+		receive(t, service, form)
+	}
+	queue.Purge()
+}
+
+func TestDeleteQueue_DeletedRecently(t *testing.T) {
+	service, queue := newTestSQS("recreated-queue")
+	form := url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	if _, _, err := service.DeleteQueue(newFormRequest(t, form)); err != nil {
+		t.Fatalf("DeleteQueue returned error: %v", err)
+	}
+	if _, _, err := service.DeleteQueue(newFormRequest(t, form)); err != ErrQueueDoesNotExist {
+		t.Errorf("expected QueueDoesNotExist, got %v", err)
+	}
+
+	form = url.Values{}
+	form.Set("QueueName", "recreated-queue")
+	if _, _, err := service.CreateQueue(newFormRequest(t, form)); err != ErrQueueDeletedRecently {
+		t.Errorf("expected QueueDeletedRecently, got %v", err)
+	}
+	service.deletedQueues["recreated-queue"] = time.Now().Add(-QueueDeletionCooldown)
+	if _, _, err := service.CreateQueue(newFormRequest(t, form)); err != nil {
+		t.Errorf("CreateQueue returned error after the cooldown: %v", err)
+	}
+}
+
+func TestDeleteMessageBatch_InvalidReceiptHandle(t *testing.T) {
+	service, queue := newTestSQS("delete-batch-queue")
+	form := url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	form.Set("DeleteMessageBatchRequestEntry.1.Id", "missing")
+	form.Set("DeleteMessageBatchRequestEntry.1.ReceiptHandle", "not-a-handle")
+	output, _, err := service.DeleteMessageBatch(newFormRequest(t, form))
+	if err != nil {
+		t.Fatalf("DeleteMessageBatch returned error: %v", err)
+	}
+	failed := output.(*DeleteMessageBatchResponse).Result.Error
+	if len(failed) != 1 || failed[0].Code != "ReceiptHandleIsInvalid" || !failed[0].SenderFault {
+		t.Errorf("unexpected failed entries %+v", failed)
+	}
+}
+
+func TestSendMessage_Validation(t *testing.T) {
+	service, queue := newTestSQS("validated-queue")
+	send := func(form url.Values) error {
+		form.Set("QueueUrl", queue.URL)
+		_, _, err := service.SendMessage(newFormRequest(t, form))
+		return err
+	}
+
+	if err := send(url.Values{}); err == nil || common.ToErrorType(err).Code != "MissingParameter" {
+		t.Errorf("expected MissingParameter for an empty body, got %v", err)
+	}
+	if err := send(url.Values{"MessageBody": {"bad \x00 character"}}); err == nil || common.ToErrorType(err).Code != "InvalidMessageContents" {
+		t.Errorf("expected InvalidMessageContents, got %v", err)
+	}
+	if err := send(url.Values{"MessageBody": {strings.Repeat("a", common.MaxMessageSize+1)}}); err == nil || common.ToErrorType(err).Code != "InvalidParameterValue" {
+		t.Errorf("expected InvalidParameterValue for a large body, got %v", err)
+	}
+
+	form := url.Values{"MessageBody": {"body"}}
+	for i := 1; i <= 11; i++ {
+		form.Set(fmt.Sprintf("MessageAttribute.%d.Name", i), fmt.Sprintf("attribute%d", i))
+		form.Set(fmt.Sprintf("MessageAttribute.%d.Value.DataType", i), "String")
+		form.Set(fmt.Sprintf("MessageAttribute.%d.Value.StringValue", i), "value")
+	}
+	if err := send(form); err == nil || common.ToErrorType(err).Code != "InvalidParameterValue" {
+		t.Errorf("expected InvalidParameterValue for 11 attributes, got %v", err)
+	}
+
+	form = url.Values{"MessageBody": {"body"}}
+	form.Set("MessageAttribute.1.Name", "count")
+	form.Set("MessageAttribute.1.Value.DataType", "Number")
+	form.Set("MessageAttribute.1.Value.StringValue", "many")
+	if err := send(form); err == nil || common.ToErrorType(err).Code != "InvalidParameterValue" {
+		t.Errorf("expected InvalidParameterValue for a non numeric Number, got %v", err)
+	}
+	if size := queue.Messages.Size(); size != 0 {
+		t.Errorf("expected no messages to be sent, got %d", size)
+	}
+}
+
+func TestCreateQueue_Validation(t *testing.T) {
+	service := NewSQS()
+	if _, _, err := service.CreateQueue(newFormRequest(t, url.Values{})); err == nil || common.ToErrorType(err).Code != "MissingParameter" {
+		t.Errorf("expected MissingParameter, got %v", err)
+	}
+	if _, _, err := service.CreateQueue(newFormRequest(t, url.Values{"QueueName": {"bad name"}})); err == nil || common.ToErrorType(err).Code != "InvalidParameterValue" {
+		t.Errorf("expected InvalidParameterValue, got %v", err)
+	}
+}
+
+func TestReceiveMessage_Validation(t *testing.T) {
+	service, queue := newTestSQS("receive-validation-queue")
+	for _, value := range []string{"0", "11", "ten"} {
+		form := url.Values{"QueueUrl": {queue.URL}, "MaxNumberOfMessages": {value}}
+		if _, _, err := service.ReceiveMessage(newFormRequest(t, form)); err == nil || common.ToErrorType(err).Code != "InvalidParameterValue" {
+			t.Errorf("expected InvalidParameterValue for MaxNumberOfMessages %s, got %v", value, err)
+		}
+	}
+}
+
+func TestDeleteMessage_ManyMessages(t *testing.T) {
+	service, queue := newTestSQS("large-queue")
+	for i := 0; i < 20000; i++ {
+		queue.Messages.Put(NewMessage([]byte(fmt.Sprintf("message %d", i)), nil, "", ""))
+	}
+	// a message whose visibility timeout expired is visible with the receipt handle of its last receive
+	published := NewMessage([]byte("published"), nil, "", "")
+	published.UpdateReceiptHandle()
+	queue.Messages.Put(published)
+
+	form := url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	form.Set("MaxNumberOfMessages", "10")
+	messages := receive(t, service, form)
+	if len(messages) != 10 || string(messages[0].MessageBody) != "message 0" {
+		t.Fatalf("expected the first 10 messages, got %d", len(messages))
+	}
+	for _, message := range messages {
+		if !queue.DeleteMessage(message.ReceiptHandle) {
+			t.Errorf("could not delete message %s", message.MessageId)
+		}
+	}
+	if !queue.DeleteMessage(published.ReceiptHandle) {
+		t.Error("could not delete a visible message by receipt handle")
+	}
+	if queue.DeleteMessage(published.ReceiptHandle) {
+		t.Error("expected a deleted receipt handle to be unknown")
+	}
+	if size := queue.Messages.Size(); size != 19990 {
+		t.Errorf("expected 19990 messages left, got %d", size)
+	}
+}
+
+func TestFindQueue(t *testing.T) {
+	service, queue := newTestSQS("subscribed-queue")
+	for _, endpoint := range []string{queue.Arn, queue.URL, "http://goaws:4100/subscribed-queue"} {
+		if found := service.FindQueue(endpoint); found != queue {
+			t.Errorf("expected %s to resolve to the queue, got %v", endpoint, found)
+		}
+	}
+	if found := service.FindQueue("arn:aws:sqs:local:000000000000:missing"); found != nil {
+		t.Errorf("expected no queue, got %v", found.Name)
+	}
+}
+
+func TestReceiveMessage_RedrivePolicyFifo(t *testing.T) {
+	service := NewSQS()
+	queue := NewQueue("redrive-source.fifo", "localhost:4100")
+	deadLetterQueue := NewQueue("redrive-dead-letter.fifo", "localhost:4100")
+	for _, q := range []*Queue{queue, deadLetterQueue} {
+		if err := q.SetAttributes(map[string]string{"ContentBasedDeduplication": "true"}); err != nil {
+			t.Fatal(err)
+		}
+		service.AddQueue(q)
+	}
+	if err := queue.SetAttributes(map[string]string{
+		"RedrivePolicy": `{"deadLetterTargetArn":"` + deadLetterQueue.Arn + `","maxReceiveCount":"1"}`}); err != nil {
+		t.Fatal(err)
+	}
+	send := func(q *Queue, body string) {
+		message := NewMessage([]byte(body), nil, "", "")
+		message.MessageGroupId = "group"
+		if _, err := q.SendMessage(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, body := range []string{"dead-1", "dead-2", "dead-3"} {
+		send(deadLetterQueue, body)
+	}
+	send(queue, "poison")
+
+	form := url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	messages := receive(t, service, form)
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	if err := queue.ChangeVisibilityTimeout(messages[0].ReceiptHandle, 0); err != nil {
+		t.Fatal(err)
+	}
+	if messages := receive(t, service, form); len(messages) != 0 {
+		t.Fatalf("expected the message to be redriven, got %d", len(messages))
+	}
+
+	var bodies []string
+	previous := ""
+	for _, message := range deadLetterQueue.Peek() {
+		bodies = append(bodies, string(message.MessageBody))
+		if message.SequenceNumber <= previous {
+			t.Errorf("sequence number %s does not follow %s", message.SequenceNumber, previous)
+		}
+		previous = message.SequenceNumber
+	}
+	if strings.Join(bodies, ",") != "dead-1,dead-2,dead-3,poison" {
+		t.Errorf("expected the redriven message after the messages of the dead-letter queue, got %v", bodies)
+	}
+}
@@ -0,0 +1,287 @@
+package sqs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Tweddle-SE-Team/goaws/services/common"
+)
+
+// Queue attributes in the order GetQueueAttributes returns them
+var queueAttributeNames = []string{
+	"ApproximateNumberOfMessages",
+	"ApproximateNumberOfMessagesDelayed",
+	"ApproximateNumberOfMessagesNotVisible",
+	"ContentBasedDeduplication",
+	"CreatedTimestamp",
+	"DeduplicationScope",
+	"DelaySeconds",
+	"FifoQueue",
+	"FifoThroughputLimit",
+	"KmsDataKeyReusePeriodSeconds",
+	"KmsMasterKeyId",
+	"LastModifiedTimestamp",
+	"MaximumMessageSize",
+	"MessageRetentionPeriod",
+	"Policy",
+	"QueueArn",
+	"ReceiveMessageWaitTimeSeconds",
+	"RedriveAllowPolicy",
+	"RedrivePolicy",
+	"SqsManagedSseEnabled",
+	"VisibilityTimeout",
+}
+
+type attributeRange struct {
+	min int
+	max int
+}
+
+// Numeric attributes which can be set with SetQueueAttributes or CreateQueue and their valid range
+var intQueueAttributes = map[string]attributeRange{
+	"DelaySeconds":                  attributeRange{0, 900},
+	"KmsDataKeyReusePeriodSeconds":  attributeRange{60, 86400},
+	"MaximumMessageSize":            attributeRange{1024, common.MaxMessageSize},
+	"MessageRetentionPeriod":        attributeRange{60, 1209600},
+	"ReceiveMessageWaitTimeSeconds": attributeRange{0, 20},
+	"VisibilityTimeout":             attributeRange{0, 43200},
+}
+
+// String attributes which can be set with SetQueueAttributes or CreateQueue
+var stringQueueAttributes = map[string]bool{
+	"ContentBasedDeduplication": true,
+	"DeduplicationScope":        true,
+	"FifoThroughputLimit":       true,
+	"KmsMasterKeyId":            true,
+	"Policy":                    true,
+	"RedriveAllowPolicy":        true,
+	"RedrivePolicy":             true,
+	"SqsManagedSseEnabled":      true,
+}
+
+// Attributes which only exist on FIFO queues
+var fifoQueueAttributes = map[string]bool{
+	"ContentBasedDeduplication": true,
+	"DeduplicationScope":        true,
+	"FifoQueue":                 true,
+	"FifoThroughputLimit":       true,
+}
+
+// ExtractQueueAttributes reads the Attribute.N.Name / Attribute.N.Value pairs of CreateQueue and SetQueueAttributes
+func ExtractQueueAttributes(request *http.Request) map[string]string {
+	attributes := make(map[string]string)
+	for i := 1; true; i++ {
+		name := request.FormValue(fmt.Sprintf("Attribute.%d.Name", i))
+		if name == "" {
+			break
+		}
+		attributes[name] = request.FormValue(fmt.Sprintf("Attribute.%d.Value", i))
+	}
+	return attributes
+}
+
+// ExtractAttributeNames reads a list of names such as the AttributeName.N list of GetQueueAttributes
+func ExtractAttributeNames(request *http.Request, key string) []string {
+	names := []string{}
+	for i := 1; true; i++ {
+		name := request.FormValue(fmt.Sprintf("%s.%d", key, i))
+		if name == "" {
+			break
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func (q *Queue) validateAttribute(name string, value string) error {
+	if fifoQueueAttributes[name] && !q.FifoQueue {
+		return ErrInvalidAttributeName
+	}
+	if valueRange, ok := intQueueAttributes[name]; ok {
+		v, err := strconv.Atoi(value)
+		if err != nil || v < valueRange.min || v > valueRange.max {
+			return ErrInvalidAttributeValue
+		}
+		return nil
+	}
+	if !stringQueueAttributes[name] {
+		return ErrInvalidAttributeName
+	}
+	switch name {
+	case "RedrivePolicy":
+		if value == "" {
+			return nil
+		}
+		redrivePolicy, err := ParseRedrivePolicy(value)
+		if err != nil || redrivePolicy.DeadLetterTargetArn == "" || redrivePolicy.MaxReceiveCount < 1 || redrivePolicy.MaxReceiveCount > 1000 {
+			return ErrInvalidAttributeValue
+		}
+	case "Policy", "RedriveAllowPolicy":
+		if value != "" && !json.Valid([]byte(value)) {
+			return ErrInvalidAttributeValue
+		}
+	case "SqsManagedSseEnabled", "ContentBasedDeduplication":
+		if value != "true" && value != "false" {
+			return ErrInvalidAttributeValue
+		}
+	case "DeduplicationScope":
+		if value != "queue" && value != "messageGroup" {
+			return ErrInvalidAttributeValue
+		}
+	case "FifoThroughputLimit":
+		if value != "perQueue" && value != "perMessageGroupId" {
+			return ErrInvalidAttributeValue
+		}
+	}
+	return nil
+}
+
+// SetAttributes validates every attribute before applying any, so an invalid request leaves the queue untouched
+func (q *Queue) SetAttributes(attributes map[string]string) error {
+	for name, value := range attributes {
+		if err := q.validateAttribute(name, value); err != nil {
+			return err
+		}
+	}
+	q.lock.Lock()
+	for name, value := range attributes {
+		q.setAttribute(name, value)
+	}
+	q.LastModifiedTimestamp = time.Now().Unix()
+	q.lock.Unlock()
+	q.save()
+	return nil
+}
+
+func (q *Queue) setAttribute(name string, value string) {
+	intValue, _ := strconv.Atoi(value)
+	switch name {
+	case "ContentBasedDeduplication":
+		q.ContentBasedDeduplication = value == "true"
+	case "DeduplicationScope":
+		q.DeduplicationScope = value
+	case "DelaySeconds":
+		q.DelaySecs = intValue
+	case "FifoThroughputLimit":
+		q.FifoThroughputLimit = value
+	case "KmsDataKeyReusePeriodSeconds":
+		q.KmsDataKeyReusePeriodSeconds = intValue
+	case "KmsMasterKeyId":
+		q.KmsMasterKeyId = value
+	case "MaximumMessageSize":
+		q.MaximumMessageSize = intValue
+	case "MessageRetentionPeriod":
+		q.MessageRetentionPeriod = intValue
+	case "Policy":
+		q.Policy = value
+	case "ReceiveMessageWaitTimeSeconds":
+		q.ReceiveWaitTimeSecs = intValue
+	case "RedriveAllowPolicy":
+		q.RedriveAllowPolicy = value
+	case "RedrivePolicy":
+		q.RedrivePolicy = value
+	case "SqsManagedSseEnabled":
+		q.SqsManagedSseEnabled = value == "true"
+	case "VisibilityTimeout":
+		q.TimeoutSecs = intValue
+	}
+}
+
+// GetAttributes returns the requested attributes, "All" selects every attribute and an empty list none
+func (q *Queue) GetAttributes(names []string) ([]Attribute, error) {
+	selected := make(map[string]bool)
+	for _, name := range names {
+		if name == "All" {
+			selected = nil
+			break
+		}
+		if _, ok := intQueueAttributes[name]; !ok && !stringQueueAttributes[name] && !isReadOnlyQueueAttribute(name) {
+			return nil, ErrInvalidAttributeName
+		}
+		selected[name] = true
+	}
+	if len(selected) == 0 && selected != nil {
+		return []Attribute{}, nil
+	}
+
+	values := q.attributeValues()
+	attributes := []Attribute{}
+	for _, name := range queueAttributeNames {
+		value, ok := values[name]
+		if !ok || (selected != nil && !selected[name]) {
+			continue
+		}
+		attributes = append(attributes, Attribute{Name: name, Value: value})
+	}
+	return attributes, nil
+}
+
+func isReadOnlyQueueAttribute(name string) bool {
+	switch name {
+	case "ApproximateNumberOfMessages",
+		"ApproximateNumberOfMessagesDelayed",
+		"ApproximateNumberOfMessagesNotVisible",
+		"CreatedTimestamp",
+		"FifoQueue",
+		"LastModifiedTimestamp",
+		"QueueArn":
+		return true
+	}
+	return false
+}
+
+// attributeValues holds the current value of every attribute, unset optional attributes are left out
+func (q *Queue) attributeValues() map[string]string {
+	notVisible := q.InFlightSize()
+	delayed := q.DelayedSize()
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	values := map[string]string{
+		"ApproximateNumberOfMessages":           strconv.Itoa(q.Messages.Size()),
+		"ApproximateNumberOfMessagesDelayed":    strconv.Itoa(delayed),
+		"ApproximateNumberOfMessagesNotVisible": strconv.Itoa(notVisible),
+		"CreatedTimestamp":                      strconv.FormatInt(q.CreatedTimestamp, 10),
+		"DelaySeconds":                          strconv.Itoa(q.DelaySecs),
+		"LastModifiedTimestamp":                 strconv.FormatInt(q.LastModifiedTimestamp, 10),
+		"MaximumMessageSize":                    strconv.Itoa(q.MaximumMessageSize),
+		"MessageRetentionPeriod":                strconv.Itoa(q.MessageRetentionPeriod),
+		"QueueArn":                              q.Arn,
+		"ReceiveMessageWaitTimeSeconds":         strconv.Itoa(q.ReceiveWaitTimeSecs),
+		"SqsManagedSseEnabled":                  strconv.FormatBool(q.SqsManagedSseEnabled),
+		"VisibilityTimeout":                     strconv.Itoa(q.TimeoutSecs),
+	}
+	if q.FifoQueue {
+		values["ContentBasedDeduplication"] = strconv.FormatBool(q.ContentBasedDeduplication)
+		values["DeduplicationScope"] = q.DeduplicationScope
+		values["FifoQueue"] = "true"
+		values["FifoThroughputLimit"] = q.FifoThroughputLimit
+	}
+	if q.KmsMasterKeyId != "" {
+		values["KmsMasterKeyId"] = q.KmsMasterKeyId
+		values["KmsDataKeyReusePeriodSeconds"] = strconv.Itoa(q.KmsDataKeyReusePeriodSeconds)
+	}
+	if q.Policy != "" {
+		values["Policy"] = q.Policy
+	}
+	if q.RedriveAllowPolicy != "" {
+		values["RedriveAllowPolicy"] = q.RedriveAllowPolicy
+	}
+	if q.RedrivePolicy != "" {
+		values["RedrivePolicy"] = q.RedrivePolicy
+	}
+	return values
+}
+
+// HasAttributes reports whether the queue already carries the given attribute values
+func (q *Queue) HasAttributes(attributes map[string]string) bool {
+	values := q.attributeValues()
+	for name, value := range attributes {
+		if values[name] != value {
+			return false
+		}
+	}
+	return true
+}
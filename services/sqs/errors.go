@@ -5,24 +5,120 @@ import (
 	"net/http"
 )
 
-var Errors = map[string]common.ErrorType{
-	"QueueNotFound": common.ErrorType{
+var (
+	ErrQueueDoesNotExist = &common.ErrorType{
 		HttpError: http.StatusBadRequest,
-		Type:      "Not Found",
+		Type:      "Sender",
 		Code:      "AWS.SimpleQueueService.NonExistentQueue",
-		Message:   "The specified queue does not exist for this wsdl version."},
-	"QueueExists": common.ErrorType{
-		HttpError: http.StatusBadRequest,
-		Type:      "Duplicate",
-		Code:      "AWS.SimpleQueueService.QueueExists",
-		Message:   "The specified queue already exists."},
-	"MessageDoesNotExist": common.ErrorType{
-		HttpError: http.StatusNotFound,
-		Type:      "Not Found",
-		Code:      "AWS.SimpleQueueService.QueueExists",
-		Message:   "The specified queue does not contain the message specified."},
-	"GeneralError": common.ErrorType{
-		HttpError: http.StatusBadRequest,
-		Type:      "GeneralError",
-		Code:      "AWS.SimpleQueueService.GeneralError",
-		Message:   "General Error."}}
+		Message:   "The specified queue does not exist for this wsdl version."}
+	ErrQueueAlreadyExists = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "QueueAlreadyExists",
+		Message:   "A queue already exists with the same name and a different value for attribute(s)."}
+	ErrQueueDeletedRecently = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "AWS.SimpleQueueService.QueueDeletedRecently",
+		Message:   "You must wait 60 seconds after deleting a queue before you can create another queue with the same name."}
+	ErrInvalidParameterValue = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "InvalidParameterValue",
+		Message:   "An invalid or out-of-range value was supplied for the input parameter."}
+	ErrMissingParameter = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "MissingParameter",
+		Message:   "A required parameter for the specified action is not supplied."}
+	ErrInvalidMessageContents = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "InvalidMessageContents",
+		Message:   "The message contains characters outside the allowed set."}
+	ErrInvalidAttributeName = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "InvalidAttributeName",
+		Message:   "The specified attribute doesn't exist."}
+	ErrInvalidAttributeValue = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "InvalidAttributeValue",
+		Message:   "A queue attribute value is invalid."}
+	ErrReceiptHandleIsInvalid = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "ReceiptHandleIsInvalid",
+		Message:   "The specified receipt handle isn't valid."}
+	ErrMessageNotInflight = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "AWS.SimpleQueueService.MessageNotInflight",
+		Message:   "The specified message isn't in flight."}
+	ErrInvalidVisibilityTimeout = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "InvalidParameterValue",
+		Message:   "Value for parameter VisibilityTimeout is invalid. Reason: Must be between 0 and 43200."}
+	ErrInvalidDelaySeconds = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "InvalidParameterValue",
+		Message:   "Value for parameter DelaySeconds is invalid. Reason: Must be between 0 and 900."}
+	ErrInvalidWaitTimeSeconds = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "InvalidParameterValue",
+		Message:   "Value for parameter WaitTimeSeconds is invalid. Reason: Must be >= 0 and <= 20."}
+	ErrEmptyBatchRequest = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "AWS.SimpleQueueService.EmptyBatchRequest",
+		Message:   "The batch request doesn't contain any entries."}
+	ErrTooManyEntriesInBatchRequest = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "AWS.SimpleQueueService.TooManyEntriesInBatchRequest",
+		Message:   "The batch request contains more entries than permissible."}
+	ErrBatchEntryIdsNotDistinct = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "AWS.SimpleQueueService.BatchEntryIdsNotDistinct",
+		Message:   "Two or more batch entries in the request have the same Id."}
+	ErrInvalidBatchEntryId = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "AWS.SimpleQueueService.InvalidBatchEntryId",
+		Message:   "The Id of a batch entry in a batch request doesn't abide by the specification."}
+	ErrBatchRequestTooLong = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "AWS.SimpleQueueService.BatchRequestTooLong",
+		Message:   "The length of all the messages put together is more than the limit."}
+	ErrInvalidFifoQueueName = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "InvalidParameterValue",
+		Message:   "The name of a FIFO queue can only include alphanumeric characters, hyphens, or underscores, must end with .fifo suffix."}
+	ErrMissingMessageGroupId = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "MissingParameter",
+		Message:   "The request must contain the parameter MessageGroupId."}
+	ErrMissingMessageDeduplicationId = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "InvalidParameterValue",
+		Message:   "The queue should either have ContentBasedDeduplication enabled or MessageDeduplicationId provided explicitly."}
+	ErrInvalidParameterForQueueType = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "InvalidParameterValue",
+		Message:   "The request include parameter that is not valid for this queue type."}
+	ErrSerializationException = &common.ErrorType{
+		HttpError: http.StatusBadRequest,
+		Type:      "Sender",
+		Code:      "SerializationException",
+		Message:   "The request body is not a valid JSON object."}
+)
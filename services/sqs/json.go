@@ -0,0 +1,204 @@
+package sqs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Tweddle-SE-Team/goaws/services/common"
+)
+
+// JSONTargetPrefix is the X-Amz-Target prefix of SQS requests sent with the AWS JSON 1.0 protocol
+const JSONTargetPrefix = "AmazonSQS."
+
+// JSONErrorNamespace prefixes the name of an error in the __type of AWS JSON protocol errors
+const JSONErrorNamespace = "com.amazonaws.sqs#"
+
+// jsonErrorTypes are the __type of errors whose JSON name is not their query protocol code
+var jsonErrorTypes = map[string]string{
+	"AWS.SimpleQueueService.NonExistentQueue": JSONErrorNamespace + "QueueDoesNotExist",
+	"QueueAlreadyExists":                      JSONErrorNamespace + "QueueNameExists",
+	"SerializationException":                  "com.amazon.coral.service#SerializationException",
+}
+
+// JSON list members and the query parameter name of their elements
+var jsonListParameters = map[string]string{
+	"AttributeNames":              "AttributeName",
+	"MessageAttributeNames":       "MessageAttributeName",
+	"MessageSystemAttributeNames": "MessageSystemAttributeName",
+}
+
+// DecodeJSONRequest translates an AWS JSON 1.0 request body into the form values the query protocol handlers read
+func DecodeJSONRequest(request *http.Request, action string) error {
+	body := make(map[string]interface{})
+	decoder := json.NewDecoder(request.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil && err.Error() != "EOF" {
+		return ErrSerializationException
+	}
+	form := url.Values{}
+	form.Set("Action", action)
+	encodeJSONParameters(form, "", body, action)
+	request.Form = form
+	request.PostForm = form
+	return nil
+}
+
+func encodeJSONParameters(form url.Values, prefix string, members map[string]interface{}, action string) {
+	for name, value := range members {
+		key := prefix + name
+		switch name {
+		case "Attributes":
+			if attributes, ok := value.(map[string]interface{}); ok {
+				for i, attributeName := range common.SortKeys(attributes) {
+					form.Set(fmt.Sprintf("%sAttribute.%d.Name", prefix, i+1), attributeName)
+					form.Set(fmt.Sprintf("%sAttribute.%d.Value", prefix, i+1), jsonScalar(attributes[attributeName]))
+				}
+			}
+			continue
+		case "MessageAttributes":
+			if attributes, ok := value.(map[string]interface{}); ok {
+				for i, attributeName := range common.SortKeys(attributes) {
+					attributePrefix := fmt.Sprintf("%sMessageAttribute.%d.", prefix, i+1)
+					form.Set(attributePrefix+"Name", attributeName)
+					if fields, ok := attributes[attributeName].(map[string]interface{}); ok {
+						for field, fieldValue := range fields {
+							form.Set(attributePrefix+"Value."+field, jsonScalar(fieldValue))
+						}
+					}
+				}
+			}
+			continue
+		case "Entries":
+			if entries, ok := value.([]interface{}); ok {
+				for i, entry := range entries {
+					if fields, ok := entry.(map[string]interface{}); ok {
+						encodeJSONParameters(form, fmt.Sprintf("%sRequestEntry.%d.", action, i+1), fields, action)
+					}
+				}
+			}
+			continue
+		}
+		if element, ok := jsonListParameters[name]; ok {
+			if values, ok := value.([]interface{}); ok {
+				for i, v := range values {
+					form.Set(fmt.Sprintf("%s%s.%d", prefix, element, i+1), jsonScalar(v))
+				}
+			}
+			continue
+		}
+		form.Set(key, jsonScalar(value))
+	}
+}
+
+func jsonScalar(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case nil:
+		return ""
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+// MarshalJSON encodes a received message in the shape of the JSON protocol
+func (m *Message) MarshalJSON() ([]byte, error) {
+	type jsonMessage struct {
+		MessageId              string                              `json:"MessageId"`
+		ReceiptHandle          string                              `json:"ReceiptHandle"`
+		MD5OfBody              string                              `json:"MD5OfBody"`
+		Body                   string                              `json:"Body"`
+		Attributes             map[string]string                   `json:"Attributes,omitempty"`
+		MD5OfMessageAttributes string                              `json:"MD5OfMessageAttributes,omitempty"`
+		MessageAttributes      map[string]SqsMessageAttributeValue `json:"MessageAttributes,omitempty"`
+	}
+	encoded := jsonMessage{
+		MessageId:              m.MessageId,
+		ReceiptHandle:          m.ReceiptHandle,
+		MD5OfBody:              m.MD5OfMessageBody,
+		Body:                   string(m.MessageBody),
+		MD5OfMessageAttributes: m.MD5OfMessageAttributes,
+	}
+	if len(m.Attributes) > 0 {
+		encoded.Attributes = make(map[string]string)
+		for _, attribute := range m.Attributes {
+			encoded.Attributes[attribute.Name] = attribute.Value
+		}
+	}
+	if len(m.MessageAttributes) > 0 {
+		encoded.MessageAttributes = make(map[string]SqsMessageAttributeValue)
+		for _, attribute := range m.MessageAttributes {
+			encoded.MessageAttributes[attribute.Name] = attribute.Value
+		}
+	}
+	return json.Marshal(encoded)
+}
+
+// JSONErrorType returns the __type of an error in the AWS JSON protocol, its namespaced JSON name.
+// The query protocol code is sent in the x-amzn-query-error header instead
+func JSONErrorType(e *common.ErrorType) string {
+	if errorType, ok := jsonErrorTypes[e.Code]; ok {
+		return errorType
+	}
+	return JSONErrorNamespace + strings.TrimPrefix(e.Code, "AWS.SimpleQueueService.")
+}
+
+// IsJSONAction reports whether an X-Amz-Target names an SQS action and returns the action
+func IsJSONAction(target string) (string, bool) {
+	if !strings.HasPrefix(target, JSONTargetPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(target, JSONTargetPrefix), true
+}
+
+/*** JSON protocol results ***/
+func (r *ChangeMessageVisibilityResponse) JSONResult() interface{} { return struct{}{} }
+func (r *ChangeMessageVisibilityBatchResponse) JSONResult() interface{} {
+	return batchJSONResult(r.Result.Entry, r.Result.Error)
+}
+func (r *ListQueuesResponse) JSONResult() interface{}                 { return r.Result }
+func (r *ListDeadLetterSourceQueuesResponse) JSONResult() interface{} { return r.Result }
+func (r *CreateQueueResponse) JSONResult() interface{}                { return r.Result }
+func (r *SendMessageResponse) JSONResult() interface{}                { return r.Result }
+func (r *SendMessageBatchResponse) JSONResult() interface{} {
+	return batchJSONResult(r.Result.Entry, r.Result.Error)
+}
+func (r *ReceiveMessageResponse) JSONResult() interface{} { return r.Result }
+func (r *DeleteMessageResponse) JSONResult() interface{}  { return struct{}{} }
+func (r *DeleteQueueResponse) JSONResult() interface{}    { return struct{}{} }
+func (r *DeleteMessageBatchResponse) JSONResult() interface{} {
+	return batchJSONResult(r.Result.Entry, r.Result.Error)
+}
+func (r *PurgeQueueResponse) JSONResult() interface{}  { return struct{}{} }
+func (r *GetQueueUrlResponse) JSONResult() interface{} { return r.Result }
+func (r *GetQueueAttributesResponse) JSONResult() interface{} {
+	attributes := make(map[string]string)
+	for _, attribute := range r.Result.Attrs {
+		attributes[attribute.Name] = attribute.Value
+	}
+	return struct {
+		Attributes map[string]string `json:"Attributes"`
+	}{attributes}
+}
+func (r *SetQueueAttributesResponse) JSONResult() interface{} { return struct{}{} }
+
+// batchJSONResult always includes both lists, an empty list is sent rather than null
+func batchJSONResult(successful interface{}, failed []BatchResultErrorEntry) interface{} {
+	if failed == nil {
+		failed = []BatchResultErrorEntry{}
+	}
+	return struct {
+		Successful interface{}             `json:"Successful"`
+		Failed     []BatchResultErrorEntry `json:"Failed"`
+	}{successful, failed}
+}
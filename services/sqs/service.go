@@ -2,29 +2,54 @@ package sqs
 
 import (
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"github.com/Tweddle-SE-Team/goaws/services/common"
 	"github.com/Tweddle-SE-Team/goaws/services/common/queue"
+	"github.com/Tweddle-SE-Team/goaws/services/storage"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// DeduplicationInterval is how long FIFO queues remember a MessageDeduplicationId
+const DeduplicationInterval = 5 * time.Minute
+
+// QueueDeletionCooldown is how long a deleted queue name stays unavailable
+const QueueDeletionCooldown = 60 * time.Second
+
 // Message struct
 
 type Message struct {
-	MessageBody            []byte                `xml:"Body,omitempty"`
-	MessageAttributes      []SqsMessageAttribute `xml:"MessageAttribute,omitempty"`
-	MessageId              string                `xml:"MessageId,omitempty"`
-	MD5OfMessageAttributes string                `xml:"MD5OfMessageAttributes,omitempty"`
-	MD5OfMessageBody       string                `xml:"MD5OfBody,omitempty"`
-	ReceiptHandle          string                `xml:"ReceiptHandle,omitempty"`
-	ReceiptTime            time.Time
+	MessageBody              []byte                `xml:"Body,omitempty"`
+	MessageAttributes        []SqsMessageAttribute `xml:"MessageAttribute,omitempty"`
+	MessageId                string                `xml:"MessageId,omitempty"`
+	MD5OfMessageAttributes   string                `xml:"MD5OfMessageAttributes,omitempty"`
+	MD5OfMessageBody         string                `xml:"MD5OfBody,omitempty"`
+	ReceiptHandle            string                `xml:"ReceiptHandle,omitempty"`
+	Attributes               []Attribute           `xml:"Attribute,omitempty"`
+	ReceiptTime              time.Time             `xml:"-"`
+	SentTime                 time.Time             `xml:"-"`
+	FirstReceiveTime         time.Time             `xml:"-"`
+	DeadLetterQueueSourceArn string                `xml:"-"`
+	VisibilityDeadline       time.Time             `xml:"-"`
+	ApproximateReceiveCount  int                   `xml:"-"`
+	MessageGroupId           string                `xml:"-"`
+	MessageDeduplicationId   string                `xml:"-"`
+	SequenceNumber           string                `xml:"-"`
+	DelaySeconds             int                   `xml:"-"`
+	VisibleTime              time.Time             `xml:"-"`
+	visibilityTimer          *time.Timer           `xml:"-"`
+	delayTimer               *time.Timer           `xml:"-"`
 }
 
 func GetQueueNameFromRequest(request *http.Request) string {
@@ -48,11 +73,23 @@ func NewMessage(MessageBody []byte, MessageAttributes []SqsMessageAttribute, Rec
 		MessageAttributes:      MessageAttributes,
 		MessageId:              MessageId,
 		ReceiptTime:            time.Now(),
+		SentTime:               time.Now(),
+		DelaySeconds:           -1,
 		ReceiptHandle:          ReceiptHandle,
 		MD5OfMessageBody:       common.GetMD5Hash(string(MessageBody[:])),
 		MD5OfMessageAttributes: md5OfMessageAttributes}
 }
 
+// messageKeys indexes visible messages by message ID and receipt handle
+func messageKeys(v interface{}) []string {
+	message := v.(*Message)
+	keys := []string{"id:" + message.MessageId}
+	if message.ReceiptHandle != "" {
+		keys = append(keys, "handle:"+message.ReceiptHandle)
+	}
+	return keys
+}
+
 func (c *Message) UpdateReceiptHandle() {
 	c.ReceiptTime = time.Now()
 	uuid, _ := common.NewUUID()
@@ -62,64 +99,779 @@ func (c *Message) UpdateReceiptHandle() {
 // Queue struct
 
 type Queue struct {
-	Name        string
-	URL         string
-	Arn         string
-	TimeoutSecs int
-	Messages    *queue.BlockingQueue
+	Name                         string
+	URL                          string
+	Arn                          string
+	TimeoutSecs                  int
+	ReceiveWaitTimeSecs          int
+	DelaySecs                    int
+	MaximumMessageSize           int
+	MessageRetentionPeriod       int
+	Policy                       string
+	RedrivePolicy                string
+	RedriveAllowPolicy           string
+	KmsMasterKeyId               string
+	KmsDataKeyReusePeriodSeconds int
+	SqsManagedSseEnabled         bool
+	FifoQueue                    bool
+	ContentBasedDeduplication    bool
+	DeduplicationScope           string
+	FifoThroughputLimit          string
+	CreatedTimestamp             int64
+	LastModifiedTimestamp        int64
+	Messages                     *queue.BlockingQueue
+	InFlight                     map[string]*Message
+	Delayed                      map[string]*Message
+	ExpiredMessages              int
+	deduplication                map[string]*Message
+	deduplicationKeys            []string
+	sequenceNumber               uint64
+	// store holds a storeRef, request handlers and timers read it without q.lock
+	store atomic.Value
+	lock  sync.Mutex
+	// sendLock orders FIFO sends: a message is queued before the next one gets its sequence number.
+	// It is taken before q.lock
+	sendLock sync.Mutex
 }
 
 func NewQueue(name string, host string) *Queue {
+	now := time.Now().Unix()
 	return &Queue{
-		Name:        name,
-		URL:         fmt.Sprintf("http://%s/queue/%s", host, name),
-		TimeoutSecs: 30,
-		Arn:         fmt.Sprintf("http://%s/queue/%s", host, name),
-		Messages:    queue.New()}
+		Name:                         name,
+		URL:                          fmt.Sprintf("http://%s/queue/%s", host, name),
+		TimeoutSecs:                  30,
+		MaximumMessageSize:           common.MaxMessageSize,
+		MessageRetentionPeriod:       345600,
+		KmsDataKeyReusePeriodSeconds: 300,
+		SqsManagedSseEnabled:         false,
+		FifoQueue:                    strings.HasSuffix(name, ".fifo"),
+		DeduplicationScope:           "queue",
+		FifoThroughputLimit:          "perQueue",
+		CreatedTimestamp:             now,
+		LastModifiedTimestamp:        now,
+		Arn:                          "arn:aws:sqs:local:000000000000:" + name,
+		Messages:                     queue.NewIndexed(messageKeys),
+		InFlight:                     make(map[string]*Message),
+		Delayed:                      make(map[string]*Message),
+		deduplication:                make(map[string]*Message)}
+}
+
+// SendMessage puts a message on the queue. FIFO queues assign it a sequence number, or return the
+// original message if one with the same deduplication id was sent within the deduplication interval.
+func (q *Queue) SendMessage(message *Message) (*Message, error) {
+	if message.DelaySeconds > 900 {
+		return nil, ErrInvalidDelaySeconds
+	}
+	q.lock.Lock()
+	maximumMessageSize, fifoQueue := q.MaximumMessageSize, q.FifoQueue
+	q.lock.Unlock()
+	if size := MessageSize(string(message.MessageBody), message.MessageAttributes); size > maximumMessageSize {
+		return nil, ErrInvalidParameterValue.WithMessage(fmt.Sprintf("One or more parameters are invalid. Reason: Message must be shorter than %d bytes.", maximumMessageSize))
+	}
+	if !fifoQueue {
+		if message.MessageDeduplicationId != "" {
+			return nil, ErrInvalidParameterForQueueType
+		}
+		q.deliver(message)
+		return message, nil
+	}
+	// FIFO queues only have the queue delay, an explicit delay of 0 is accepted and leaves it in place
+	if message.DelaySeconds > 0 {
+		return nil, ErrInvalidParameterForQueueType
+	}
+	message.DelaySeconds = -1
+	if message.MessageGroupId == "" {
+		return nil, ErrMissingMessageGroupId
+	}
+	q.sendLock.Lock()
+	defer q.sendLock.Unlock()
+	q.lock.Lock()
+	if message.MessageDeduplicationId == "" {
+		if !q.ContentBasedDeduplication {
+			q.lock.Unlock()
+			return nil, ErrMissingMessageDeduplicationId
+		}
+		hash := sha256.Sum256(message.MessageBody)
+		message.MessageDeduplicationId = hex.EncodeToString(hash[:])
+	}
+	deduplicationKey := message.MessageDeduplicationId
+	if q.DeduplicationScope == "messageGroup" {
+		deduplicationKey = message.MessageGroupId + ":" + deduplicationKey
+	}
+	now := time.Now()
+	q.pruneDeduplication(now)
+	if original, ok := q.deduplication[deduplicationKey]; ok && now.Sub(original.SentTime) <= DeduplicationInterval {
+		q.lock.Unlock()
+		return original, nil
+	}
+	q.sequenceNumber++
+	message.SequenceNumber = fmt.Sprintf("%020d", q.sequenceNumber)
+	q.addDeduplication(deduplicationKey, message)
+	q.lock.Unlock()
+	q.save()
+	q.deliver(message)
+	return message, nil
+}
+
+// addDeduplication remembers a sent message for the deduplication interval, q.lock must be held
+func (q *Queue) addDeduplication(key string, message *Message) {
+	q.deduplication[key] = message
+	q.deduplicationKeys = append(q.deduplicationKeys, key)
+}
+
+// pruneDeduplication forgets the oldest messages which left the deduplication interval, q.lock must be held
+func (q *Queue) pruneDeduplication(now time.Time) {
+	i := 0
+	for ; i < len(q.deduplicationKeys); i++ {
+		key := q.deduplicationKeys[i]
+		sent, ok := q.deduplication[key]
+		if ok && now.Sub(sent.SentTime) <= DeduplicationInterval {
+			break
+		}
+		delete(q.deduplication, key)
+	}
+	q.deduplicationKeys = q.deduplicationKeys[i:]
+}
+
+// deliver puts a message on the queue, delayed messages stay invisible until their delay expires
+func (q *Queue) deliver(message *Message) {
+	q.lock.Lock()
+	delaySeconds := q.DelaySecs
+	if message.DelaySeconds >= 0 {
+		delaySeconds = message.DelaySeconds
+	}
+	if delaySeconds == 0 {
+		q.saveMessage(message, messageVisible)
+		q.lock.Unlock()
+		q.Messages.Put(message)
+		return
+	}
+	delay := time.Duration(delaySeconds) * time.Second
+	message.VisibleTime = time.Now().Add(delay)
+	messageId := message.MessageId
+	message.delayTimer = time.AfterFunc(delay, func() {
+		q.ExpireDelay(messageId)
+	})
+	q.Delayed[messageId] = message
+	q.saveMessage(message, messageDelayed)
+	q.lock.Unlock()
+}
+
+// ExpireDelay makes a delayed message visible.
+func (q *Queue) ExpireDelay(messageId string) bool {
+	q.lock.Lock()
+	message, ok := q.Delayed[messageId]
+	if ok {
+		message.delayTimer = nil
+		delete(q.Delayed, messageId)
+	}
+	q.lock.Unlock()
+	if !ok {
+		return false
+	}
+	return q.requeue(message)
+}
+
+// DelayedSize is the number of messages waiting for their delivery delay to expire.
+func (q *Queue) DelayedSize() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.Delayed)
+}
+
+// ExpireMessages discards every message older than the queue's MessageRetentionPeriod,
+// returns how many were discarded.
+func (q *Queue) ExpireMessages(now time.Time) int {
+	q.lock.Lock()
+	retention := time.Duration(q.MessageRetentionPeriod) * time.Second
+	expired := 0
+	for messageId, message := range q.Delayed {
+		if now.Sub(message.SentTime) > retention {
+			message.delayTimer.Stop()
+			delete(q.Delayed, messageId)
+			q.forgetMessage(message)
+			expired++
+		}
+	}
+	for receiptHandle, message := range q.InFlight {
+		if now.Sub(message.SentTime) > retention {
+			message.visibilityTimer.Stop()
+			delete(q.InFlight, receiptHandle)
+			q.forgetMessage(message)
+			expired++
+		}
+	}
+	q.lock.Unlock()
+
+	for _, message := range q.visibleMessages() {
+		if now.Sub(message.SentTime) > retention && q.removeVisible(message) {
+			q.forgetMessage(message)
+			expired++
+		}
+	}
+
+	q.lock.Lock()
+	q.ExpiredMessages += expired
+	q.lock.Unlock()
+	if expired > 0 {
+		q.save()
+		log.Debugf("Discarded %d messages past the retention period of %s", expired, q.Name)
+	}
+	return expired
+}
+
+// Purge deletes every message of the queue, including delayed and in-flight ones.
+func (q *Queue) Purge() {
+	visible := q.visibleMessages()
+	q.Messages.Empty()
+	for _, message := range visible {
+		q.forgetMessage(message)
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for _, message := range q.Delayed {
+		message.delayTimer.Stop()
+		q.forgetMessage(message)
+	}
+	for _, message := range q.InFlight {
+		message.visibilityTimer.Stop()
+		q.forgetMessage(message)
+	}
+	q.Delayed = make(map[string]*Message)
+	q.InFlight = make(map[string]*Message)
+}
+
+// requeue makes a message visible again, FIFO queues keep it ahead of the later messages of its group
+func (q *Queue) requeue(message *Message) bool {
+	q.lock.Lock()
+	q.saveMessage(message, messageVisible)
+	fifoQueue := q.FifoQueue
+	q.lock.Unlock()
+	return q.putVisible(message, fifoQueue)
+}
+
+// redrive moves a message of another queue onto this dead-letter queue. A FIFO dead-letter queue
+// gives it its next sequence number, so it follows the messages already on the queue
+func (q *Queue) redrive(message *Message) bool {
+	q.sendLock.Lock()
+	defer q.sendLock.Unlock()
+	q.lock.Lock()
+	fifoQueue := q.FifoQueue
+	if fifoQueue {
+		q.sequenceNumber++
+		message.SequenceNumber = fmt.Sprintf("%020d", q.sequenceNumber)
+	}
+	q.saveMessage(message, messageVisible)
+	q.lock.Unlock()
+	if fifoQueue {
+		q.save()
+	}
+	return q.putVisible(message, fifoQueue)
+}
+
+// putVisible puts a message on the queue, in sequence number order on FIFO queues. Callers must not hold q.lock
+func (q *Queue) putVisible(message *Message, fifoQueue bool) bool {
+	if !fifoQueue {
+		return q.Messages.Put(message)
+	}
+	sequenceLess := func(v interface{}, item interface{}) bool {
+		return v.(*Message).SequenceNumber < item.(*Message).SequenceNumber
+	}
+	return q.Messages.PutSorted(message, sequenceLess)
+}
+
+// removeVisible takes a message off the queue, returns false if another consumer took it first
+func (q *Queue) removeVisible(message *Message) bool {
+	return q.Messages.RemoveKey("id:"+message.MessageId) != nil
+}
+
+// Peek lists the visible messages in order without receiving them
+func (q *Queue) Peek() []*Message {
+	return q.visibleMessages()
+}
+
+// visibleMessages lists the messages on the queue in order
+func (q *Queue) visibleMessages() []*Message {
+	var messages []*Message
+	for m := range q.Messages.Iterator() {
+		messages = append(messages, m.(*Message))
+	}
+	return messages
+}
+
+// inFlightGroups lists the FIFO message groups which have a message in flight and may not be received
+func (q *Queue) inFlightGroups() map[string]bool {
+	groups := make(map[string]bool)
+	if !q.FifoQueue {
+		return groups
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for _, message := range q.InFlight {
+		groups[message.MessageGroupId] = true
+	}
+	return groups
+}
+
+// ReceiveMessages takes up to max visible messages off the queue and puts them in flight.
+// Messages received more often than the redrive policy allows are moved to deadLetterQueue instead.
+func (q *Queue) ReceiveMessages(max int, visibilityTimeout time.Duration, deadLetterQueue *Queue) []*Message {
+	maxReceiveCount := 0
+	if redrivePolicy := q.GetRedrivePolicy(); redrivePolicy != nil && deadLetterQueue != nil {
+		maxReceiveCount = redrivePolicy.MaxReceiveCount
+	}
+	blockedGroups := q.inFlightGroups()
+	var candidates []*Message
+	q.Messages.Scan(func(m interface{}) bool {
+		if message := m.(*Message); !blockedGroups[message.MessageGroupId] {
+			candidates = append(candidates, message)
+		}
+		return len(candidates) < max
+	})
+	var messages []*Message
+	for _, message := range candidates {
+		if blockedGroups[message.MessageGroupId] {
+			continue
+		}
+		// Another consumer may have taken the message between iterating and removing it
+		if !q.removeVisible(message) {
+			if q.FifoQueue {
+				blockedGroups[message.MessageGroupId] = true
+			}
+			continue
+		}
+		if maxReceiveCount > 0 && message.ApproximateReceiveCount >= maxReceiveCount {
+			log.Debugf("Moving message %s from %s to dead-letter queue %s", message.MessageId, q.Name, deadLetterQueue.Name)
+			message.DeadLetterQueueSourceArn = q.Arn
+			q.forgetMessage(message)
+			deadLetterQueue.redrive(message)
+			continue
+		}
+		q.StartVisibilityTimeout(message, visibilityTimeout)
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+// HasVisibleMessages reports whether a receive would return at least one message.
+func (q *Queue) HasVisibleMessages() bool {
+	if !q.FifoQueue {
+		return q.Messages.Size() > 0
+	}
+	blockedGroups := q.inFlightGroups()
+	found := false
+	q.Messages.Scan(func(m interface{}) bool {
+		found = !blockedGroups[m.(*Message).MessageGroupId]
+		return !found
+	})
+	return found
+}
+
+// StartVisibilityTimeout moves a received message into the in-flight set under a new
+// receipt handle. The message is returned to the queue once the timeout expires.
+func (q *Queue) StartVisibilityTimeout(message *Message, timeout time.Duration) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	message.UpdateReceiptHandle()
+	if message.ApproximateReceiveCount == 0 {
+		message.FirstReceiveTime = message.ReceiptTime
+	}
+	message.ApproximateReceiveCount++
+	message.VisibilityDeadline = time.Now().Add(timeout)
+	receiptHandle := message.ReceiptHandle
+	message.visibilityTimer = time.AfterFunc(timeout, func() {
+		q.ExpireVisibilityTimeout(receiptHandle)
+	})
+	q.InFlight[receiptHandle] = message
+	q.saveMessage(message, messageInFlight)
+}
+
+// ExpireVisibilityTimeout makes an in-flight message visible again.
+func (q *Queue) ExpireVisibilityTimeout(receiptHandle string) bool {
+	if message := q.RemoveInFlight(receiptHandle); message != nil {
+		return q.requeue(message)
+	}
+	return false
+}
+
+// RemoveInFlight takes a message out of the in-flight set, returns nil if the receipt handle is unknown.
+func (q *Queue) RemoveInFlight(receiptHandle string) *Message {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	message, ok := q.InFlight[receiptHandle]
+	if !ok {
+		return nil
+	}
+	if message.visibilityTimer != nil {
+		message.visibilityTimer.Stop()
+		message.visibilityTimer = nil
+	}
+	message.VisibilityDeadline = time.Time{}
+	delete(q.InFlight, receiptHandle)
+	return message
+}
+
+// ChangeVisibilityTimeout restarts the visibility timeout of an in-flight message, a zero
+// timeout makes the message visible immediately.
+func (q *Queue) ChangeVisibilityTimeout(receiptHandle string, timeout time.Duration) error {
+	if timeout == 0 {
+		if q.ExpireVisibilityTimeout(receiptHandle) {
+			return nil
+		}
+		return q.receiptHandleError(receiptHandle)
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	message, ok := q.InFlight[receiptHandle]
+	if !ok {
+		return q.receiptHandleError(receiptHandle)
+	}
+	if message.visibilityTimer != nil {
+		message.visibilityTimer.Stop()
+	}
+	message.VisibilityDeadline = time.Now().Add(timeout)
+	message.visibilityTimer = time.AfterFunc(timeout, func() {
+		q.ExpireVisibilityTimeout(receiptHandle)
+	})
+	q.saveMessage(message, messageInFlight)
+	return nil
+}
+
+// receiptHandleError tells a message which is visible again apart from an unknown receipt handle.
+func (q *Queue) receiptHandleError(receiptHandle string) error {
+	if receiptHandle != "" && q.Messages.GetKey("handle:"+receiptHandle) != nil {
+		return ErrMessageNotInflight
+	}
+	return ErrReceiptHandleIsInvalid
+}
+
+// InFlightSize is the number of messages received but not yet deleted or made visible again.
+func (q *Queue) InFlightSize() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.InFlight)
+}
+
+// DeleteMessage removes a message by receipt handle, whether it is in flight or visible again.
+func (q *Queue) DeleteMessage(receiptHandle string) bool {
+	if message := q.RemoveInFlight(receiptHandle); message != nil {
+		q.forgetMessage(message)
+		return true
+	}
+	if receiptHandle == "" {
+		return false
+	}
+	message := q.Messages.RemoveKey("handle:" + receiptHandle)
+	if message == nil {
+		return false
+	}
+	q.forgetMessage(message.(*Message))
+	return true
+}
+
+// RedrivePolicy struct
+
+type RedrivePolicy struct {
+	DeadLetterTargetArn string
+	MaxReceiveCount     int
+}
+
+// ParseRedrivePolicy accepts maxReceiveCount both as a JSON number and as a string, like AWS does
+func ParseRedrivePolicy(value string) (*RedrivePolicy, error) {
+	var policy struct {
+		DeadLetterTargetArn string      `json:"deadLetterTargetArn"`
+		MaxReceiveCount     json.Number `json:"maxReceiveCount"`
+	}
+	if err := json.Unmarshal([]byte(value), &policy); err != nil {
+		return nil, err
+	}
+	maxReceiveCount, err := policy.MaxReceiveCount.Int64()
+	if err != nil {
+		return nil, err
+	}
+	return &RedrivePolicy{
+		DeadLetterTargetArn: policy.DeadLetterTargetArn,
+		MaxReceiveCount:     int(maxReceiveCount)}, nil
+}
+
+// ReceiveDefaults returns the ReceiveMessageWaitTimeSeconds and VisibilityTimeout attributes, in seconds
+func (q *Queue) ReceiveDefaults() (waitTimeSeconds int, visibilityTimeout int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.ReceiveWaitTimeSecs, q.TimeoutSecs
+}
+
+// GetRedrivePolicy returns the parsed RedrivePolicy attribute, nil if the queue has none
+func (q *Queue) GetRedrivePolicy() *RedrivePolicy {
+	q.lock.Lock()
+	value := q.RedrivePolicy
+	q.lock.Unlock()
+	if value == "" {
+		return nil
+	}
+	redrivePolicy, err := ParseRedrivePolicy(value)
+	if err != nil {
+		return nil
+	}
+	return redrivePolicy
 }
 
 // SQS struct
 
 type SQS struct {
-	Queues *queue.BlockingQueue
+	Queues        *queue.BlockingQueue
+	sweeperStart  sync.Once
+	closeOnce     sync.Once
+	done          chan struct{}
+	deletedQueues map[string]time.Time
+	store         storage.Store
+	lock          sync.Mutex
 }
 
 func NewSQS() *SQS {
-	return &SQS{Queues: queue.New()}
+	return &SQS{Queues: queue.NewIndexed(queueKeys), deletedQueues: make(map[string]time.Time), done: make(chan struct{})}
+}
+
+// RetentionSweepInterval is how often the retention sweeper looks for expired messages
+const RetentionSweepInterval = 10 * time.Second
+
+// StartRetentionSweeper discards expired messages of every queue in the background, calling it again is a no-op
+func (c *SQS) StartRetentionSweeper(interval time.Duration) {
+	c.sweeperStart.Do(func() {
+		ticker := time.NewTicker(interval)
+		go func() {
+			defer ticker.Stop()
+			for {
+				select {
+				case now := <-ticker.C:
+					for q := range c.Queues.Iterator() {
+						q.(*Queue).ExpireMessages(now)
+					}
+				case <-c.done:
+					return
+				}
+			}
+		}()
+	})
+}
+
+// Close stops the retention sweeper, queues keep their messages
+func (c *SQS) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// queueKeys indexes queues by name, URL and ARN
+func queueKeys(v interface{}) []string {
+	q := v.(*Queue)
+	return []string{"name:" + q.Name, "url:" + q.URL, "arn:" + q.Arn}
+}
+
+func (c *SQS) GetQueue(queueName string) *Queue {
+	if q := c.Queues.GetKey("name:" + queueName); q != nil {
+		return q.(*Queue)
+	}
+	return nil
+}
+
+// FindQueue resolves an SNS subscription endpoint, the ARN or URL of a queue, to the queue.
+// URLs of another host are matched by their last path segment, the queue name.
+func (c *SQS) FindQueue(endpoint string) *Queue {
+	if q := c.Queues.GetKey("arn:" + endpoint); q != nil {
+		return q.(*Queue)
+	}
+	if q := c.Queues.GetKey("url:" + endpoint); q != nil {
+		return q.(*Queue)
+	}
+	uriSegments := strings.Split(endpoint, "/")
+	return c.GetQueue(uriSegments[len(uriSegments)-1])
+}
+
+// DeletedRecently reports whether a queue of that name was deleted within the QueueDeletionCooldown
+func (c *SQS) DeletedRecently(name string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	deleted, ok := c.deletedQueues[name]
+	if ok && time.Since(deleted) >= QueueDeletionCooldown {
+		delete(c.deletedQueues, name)
+		return false
+	}
+	return ok
+}
+
+func (c *SQS) GetQueueByArn(queueArn string) *Queue {
+	if q := c.Queues.GetKey("arn:" + queueArn); q != nil {
+		return q.(*Queue)
+	}
+	return nil
 }
 
-func (c *SQS) ExtractSqsMessageAttributes(request *http.Request) ([]SqsMessageAttribute, string) {
+// GetDeadLetterQueue resolves the dead-letter queue of the queue's redrive policy, nil if it has none
+func (c *SQS) GetDeadLetterQueue(q *Queue) *Queue {
+	if redrivePolicy := q.GetRedrivePolicy(); redrivePolicy != nil {
+		return c.GetQueueByArn(redrivePolicy.DeadLetterTargetArn)
+	}
+	return nil
+}
+
+// ExtractSqsMessageAttributes reads the MessageAttribute.N form fields, prefix selects a batch entry
+// (e.g.: "SendMessageBatchRequestEntry.1.")
+func (c *SQS) ExtractSqsMessageAttributes(request *http.Request, prefix string) ([]SqsMessageAttribute, string, error) {
 	attributes := make(map[string]SqsMessageAttribute)
 	outputAttributes := make([]SqsMessageAttribute, 0, 0)
 	for i := 1; true; i++ {
-		name := request.FormValue(fmt.Sprintf("MessageAttribute.%d.Name", i))
+		name := request.FormValue(fmt.Sprintf("%sMessageAttribute.%d.Name", prefix, i))
 		if name == "" {
 			break
 		}
-		dataType := request.FormValue(fmt.Sprintf("MessageAttribute.%d.Value.DataType", i))
+		if i > common.MaxMessageAttributes {
+			return nil, "", ErrInvalidParameterValue.WithMessage(fmt.Sprintf("Number of message attributes exceeds the allowed maximum [%d].", common.MaxMessageAttributes))
+		}
+		if err := common.ValidateMessageAttributeName(name); err != nil {
+			return nil, "", ErrInvalidParameterValue.WithMessage(err.Error())
+		}
+		if _, ok := attributes[name]; ok {
+			return nil, "", ErrInvalidParameterValue.WithMessage(fmt.Sprintf("Message attribute name '%s' is not unique.", name))
+		}
+		dataType := request.FormValue(fmt.Sprintf("%sMessageAttribute.%d.Value.DataType", prefix, i))
 		if dataType == "" {
-			log.Warnf("DataType of MessageAttribute %s is missing, MD5 checksum will most probably be wrong!\n", name)
-			continue
+			return nil, "", ErrInvalidParameterValue.WithMessage(fmt.Sprintf("The message attribute '%s' must contain non-empty message attribute type.", name))
 		}
-		for _, valueKey := range [...]string{"StringValue", "BinaryValue"} {
-			value := request.FormValue(fmt.Sprintf("MessageAttribute.%d.Value.%s", i, valueKey))
-			if value != "" {
-				messageAttributeValue := SqsMessageAttributeValue{DataType: dataType}
-				if valueKey == "StringValue" {
-					messageAttributeValue.StringValue = value
-				} else if valueKey == "BinaryValue" {
-					messageAttributeValue.BinaryValue = value
-				}
-				attribute := SqsMessageAttribute{Name: name, Value: messageAttributeValue}
-				attributes[name] = attribute
-				outputAttributes = append(outputAttributes, attribute)
-			}
+		messageAttributeValue := SqsMessageAttributeValue{DataType: dataType}
+		value := request.FormValue(fmt.Sprintf("%sMessageAttribute.%d.Value.StringValue", prefix, i))
+		if strings.HasPrefix(dataType, "Binary") {
+			value = request.FormValue(fmt.Sprintf("%sMessageAttribute.%d.Value.BinaryValue", prefix, i))
+			messageAttributeValue.BinaryValue = value
+		} else {
+			messageAttributeValue.StringValue = value
 		}
-		if _, ok := attributes[name]; !ok {
-			log.Warnf("StringValue or BinaryValue of MessageAttribute %s is missing, MD5 checksum will most probably be wrong!\n", name)
+		if err := common.ValidateMessageAttributeValue(name, dataType, value); err != nil {
+			return nil, "", ErrInvalidParameterValue.WithMessage(err.Error())
 		}
+		attribute := SqsMessageAttribute{Name: name, Value: messageAttributeValue}
+		attributes[name] = attribute
+		outputAttributes = append(outputAttributes, attribute)
 	}
-	return outputAttributes, c.HashAttributes(attributes)
+	return outputAttributes, c.HashAttributes(attributes), nil
+}
+
+// NewMessageFromRequest builds a message from the SendMessage form fields, prefix selects a batch entry
+func (c *SQS) NewMessageFromRequest(request *http.Request, prefix string) (*Message, error) {
+	messageBody := request.FormValue(prefix + "MessageBody")
+	if messageBody == "" {
+		return nil, ErrMissingParameter.WithMessage("The request must contain the parameter MessageBody.")
+	}
+	if err := common.ValidateMessageBody(messageBody); err != nil {
+		return nil, ErrInvalidMessageContents.WithMessage(err.Error())
+	}
+	messageAttributes, md5OfMessageAttributes, err := c.ExtractSqsMessageAttributes(request, prefix)
+	if err != nil {
+		return nil, err
+	}
+	message := NewMessage([]byte(messageBody), messageAttributes, "", md5OfMessageAttributes)
+	message.MessageGroupId = request.FormValue(prefix + "MessageGroupId")
+	message.MessageDeduplicationId = request.FormValue(prefix + "MessageDeduplicationId")
+	if delaySeconds := request.FormValue(prefix + "DelaySeconds"); delaySeconds != "" {
+		var err error
+		if message.DelaySeconds, err = strconv.Atoi(delaySeconds); err != nil || message.DelaySeconds < 0 {
+			return nil, ErrInvalidDelaySeconds
+		}
+	}
+	return message, nil
+}
+
+// IsValidBatchEntryId checks a batch entry Id: up to 80 alphanumeric, hyphen or underscore characters
+func IsValidBatchEntryId(id string) bool {
+	if len(id) == 0 || len(id) > 80 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// ReceivedMessage is the view of a message of the queue returned by ReceiveMessage: the requested system attributes
+// are added and message attributes are filtered by name, "All" / ".*" or a "prefix.*" wildcard.
+// The message is copied under the queue lock because its timers change it concurrently, the view leaves the timers out.
+func (c *SQS) ReceivedMessage(queue *Queue, message *Message, attributeNames []string, messageAttributeNames []string) *Message {
+	queue.lock.Lock()
+	received := *message
+	queue.lock.Unlock()
+	received.visibilityTimer = nil
+	received.delayTimer = nil
+	systemAttributes := received.SystemAttributes()
+	received.Attributes = []Attribute{}
+	for _, attribute := range systemAttributes {
+		if matchesAttributeName(attribute.Name, attributeNames) {
+			received.Attributes = append(received.Attributes, attribute)
+		}
+	}
+	received.MessageAttributes = []SqsMessageAttribute{}
+	attributes := make(map[string]SqsMessageAttribute)
+	for _, attribute := range message.MessageAttributes {
+		if matchesAttributeName(attribute.Name, messageAttributeNames) {
+			received.MessageAttributes = append(received.MessageAttributes, attribute)
+			attributes[attribute.Name] = attribute
+		}
+	}
+	received.MD5OfMessageAttributes = ""
+	if len(attributes) > 0 {
+		received.MD5OfMessageAttributes = c.HashAttributes(attributes)
+	}
+	return &received
+}
+
+func matchesAttributeName(name string, names []string) bool {
+	for _, n := range names {
+		if n == "All" || n == ".*" || n == name {
+			return true
+		}
+		if strings.HasSuffix(n, ".*") && strings.HasPrefix(name, strings.TrimSuffix(n, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// SystemAttributes lists the message system attributes ReceiveMessage can return
+func (m *Message) SystemAttributes() []Attribute {
+	attributes := []Attribute{
+		Attribute{Name: "ApproximateFirstReceiveTimestamp", Value: strconv.FormatInt(unixMilliseconds(m.FirstReceiveTime), 10)},
+		Attribute{Name: "ApproximateReceiveCount", Value: strconv.Itoa(m.ApproximateReceiveCount)},
+		Attribute{Name: "SenderId", Value: "000000000000"},
+		Attribute{Name: "SentTimestamp", Value: strconv.FormatInt(unixMilliseconds(m.SentTime), 10)},
+	}
+	if m.DeadLetterQueueSourceArn != "" {
+		attributes = append(attributes, Attribute{Name: "DeadLetterQueueSourceArn", Value: m.DeadLetterQueueSourceArn})
+	}
+	if m.MessageGroupId != "" {
+		attributes = append(attributes,
+			Attribute{Name: "MessageDeduplicationId", Value: m.MessageDeduplicationId},
+			Attribute{Name: "MessageGroupId", Value: m.MessageGroupId},
+			Attribute{Name: "SequenceNumber", Value: m.SequenceNumber})
+	}
+	return attributes
+}
+
+func unixMilliseconds(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// MessageSize is the payload size AWS counts against the 256 KiB limit: body plus attribute names, types and values
+func MessageSize(messageBody string, attributes []SqsMessageAttribute) int {
+	size := len(messageBody)
+	for _, attribute := range attributes {
+		size += len(attribute.Name) + len(attribute.Value.DataType)
+		size += len(attribute.Value.StringValue)
+		if binaryValue, err := base64.StdEncoding.DecodeString(attribute.Value.BinaryValue); err == nil {
+			size += len(binaryValue)
+		}
+	}
+	return size
 }
 
 func (c *SQS) HashAttributes(attributes map[string]SqsMessageAttribute) string {
@@ -140,5 +892,3 @@ func (c *SQS) HashAttributes(attributes map[string]SqsMessageAttribute) string {
 	}
 	return hex.EncodeToString(hasher.Sum(nil))
 }
-
-var Service *SQS = NewSQS()
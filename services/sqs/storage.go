@@ -0,0 +1,392 @@
+package sqs
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/Tweddle-SE-Team/goaws/services/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+// Buckets queues and messages are persisted in, messages are keyed by queue name and message id
+const (
+	queuesBucket   = "sqs.queues"
+	messagesBucket = "sqs.messages"
+)
+
+// Message states, a message is on the queue, received and in flight or waiting for its delivery delay
+const (
+	messageVisible  = "visible"
+	messageInFlight = "inflight"
+	messageDelayed  = "delayed"
+)
+
+// QueueRecord is the persisted form of a queue, Attributes holds the values CreateQueue accepts
+type QueueRecord struct {
+	Name                  string
+	URL                   string
+	Attributes            map[string]string
+	CreatedTimestamp      int64
+	LastModifiedTimestamp int64
+	ExpiredMessages       int
+	SequenceNumber        uint64
+}
+
+// MessageRecord is the persisted form of a message, State is visible, inflight or delayed
+type MessageRecord struct {
+	QueueName                string
+	State                    string
+	MessageId                string
+	MessageBody              []byte
+	MessageAttributes        []SqsMessageAttribute
+	MD5OfMessageAttributes   string
+	MD5OfMessageBody         string
+	ReceiptHandle            string
+	ReceiptTime              time.Time
+	SentTime                 time.Time
+	FirstReceiveTime         time.Time
+	DeadLetterQueueSourceArn string
+	VisibilityDeadline       time.Time
+	ApproximateReceiveCount  int
+	MessageGroupId           string
+	MessageDeduplicationId   string
+	SequenceNumber           string
+	DelaySeconds             int
+	VisibleTime              time.Time
+}
+
+// QueueSnapshot is a queue together with its messages
+type QueueSnapshot struct {
+	QueueRecord
+	Messages []MessageRecord
+}
+
+func messageKey(queueName string, messageId string) string {
+	return queueName + "/" + messageId
+}
+
+// record captures the queue attributes, callers must not hold q.lock
+func (q *Queue) record() QueueRecord {
+	attributes := make(map[string]string)
+	for name, value := range q.attributeValues() {
+		if _, ok := intQueueAttributes[name]; ok || stringQueueAttributes[name] {
+			attributes[name] = value
+		}
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return QueueRecord{
+		Name:                  q.Name,
+		URL:                   q.URL,
+		Attributes:            attributes,
+		CreatedTimestamp:      q.CreatedTimestamp,
+		LastModifiedTimestamp: q.LastModifiedTimestamp,
+		ExpiredMessages:       q.ExpiredMessages,
+		SequenceNumber:        q.sequenceNumber}
+}
+
+func newMessageRecord(queueName string, message *Message, state string) MessageRecord {
+	return MessageRecord{
+		QueueName:                queueName,
+		State:                    state,
+		MessageId:                message.MessageId,
+		MessageBody:              message.MessageBody,
+		MessageAttributes:        message.MessageAttributes,
+		MD5OfMessageAttributes:   message.MD5OfMessageAttributes,
+		MD5OfMessageBody:         message.MD5OfMessageBody,
+		ReceiptHandle:            message.ReceiptHandle,
+		ReceiptTime:              message.ReceiptTime,
+		SentTime:                 message.SentTime,
+		FirstReceiveTime:         message.FirstReceiveTime,
+		DeadLetterQueueSourceArn: message.DeadLetterQueueSourceArn,
+		VisibilityDeadline:       message.VisibilityDeadline,
+		ApproximateReceiveCount:  message.ApproximateReceiveCount,
+		MessageGroupId:           message.MessageGroupId,
+		MessageDeduplicationId:   message.MessageDeduplicationId,
+		SequenceNumber:           message.SequenceNumber,
+		DelaySeconds:             message.DelaySeconds,
+		VisibleTime:              message.VisibleTime}
+}
+
+func (record *MessageRecord) message() *Message {
+	return &Message{
+		MessageBody:              record.MessageBody,
+		MessageAttributes:        record.MessageAttributes,
+		MessageId:                record.MessageId,
+		MD5OfMessageAttributes:   record.MD5OfMessageAttributes,
+		MD5OfMessageBody:         record.MD5OfMessageBody,
+		ReceiptHandle:            record.ReceiptHandle,
+		ReceiptTime:              record.ReceiptTime,
+		SentTime:                 record.SentTime,
+		FirstReceiveTime:         record.FirstReceiveTime,
+		DeadLetterQueueSourceArn: record.DeadLetterQueueSourceArn,
+		VisibilityDeadline:       record.VisibilityDeadline,
+		ApproximateReceiveCount:  record.ApproximateReceiveCount,
+		MessageGroupId:           record.MessageGroupId,
+		MessageDeduplicationId:   record.MessageDeduplicationId,
+		SequenceNumber:           record.SequenceNumber,
+		DelaySeconds:             record.DelaySeconds,
+		VisibleTime:              record.VisibleTime}
+}
+
+// storeRef wraps a store so that nil and stores of any type fit in the atomic.Value of a queue
+type storeRef struct {
+	storage.Store
+}
+
+// loadStore returns the store the queue is persisted in, nil if it is not
+func (q *Queue) loadStore() storage.Store {
+	ref, _ := q.store.Load().(storeRef)
+	return ref.Store
+}
+
+func (q *Queue) setStore(store storage.Store) {
+	q.store.Store(storeRef{store})
+}
+
+// save writes the queue attributes to the store, callers must not hold q.lock
+func (q *Queue) save() {
+	store := q.loadStore()
+	if store == nil {
+		return
+	}
+	put(store, queuesBucket, q.Name, q.record())
+}
+
+// saveMessage writes a message in the given state to the store, callers must hold q.lock or own the message
+func (q *Queue) saveMessage(message *Message, state string) {
+	store := q.loadStore()
+	if store == nil {
+		return
+	}
+	put(store, messagesBucket, messageKey(q.Name, message.MessageId), newMessageRecord(q.Name, message, state))
+}
+
+// forgetMessage removes a deleted or expired message from the store
+func (q *Queue) forgetMessage(message *Message) {
+	store := q.loadStore()
+	if store == nil {
+		return
+	}
+	if err := store.Delete(messagesBucket, messageKey(q.Name, message.MessageId)); err != nil {
+		log.Errorf("Failed to delete message %s of %s from storage: %v", message.MessageId, q.Name, err)
+	}
+}
+
+func put(store storage.Store, bucket string, key string, record interface{}) {
+	value, err := json.Marshal(record)
+	if err == nil {
+		err = store.Put(bucket, key, value)
+	}
+	if err != nil {
+		log.Errorf("Failed to write %s %s to storage: %v", bucket, key, err)
+	}
+}
+
+// messageRecords captures every message of the queue: visible ones in queue order, then in-flight and delayed ones
+func (q *Queue) messageRecords() []MessageRecord {
+	records := []MessageRecord{}
+	for _, message := range q.visibleMessages() {
+		records = append(records, newMessageRecord(q.Name, message, messageVisible))
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	var hidden []MessageRecord
+	for _, message := range q.InFlight {
+		hidden = append(hidden, newMessageRecord(q.Name, message, messageInFlight))
+	}
+	for _, message := range q.Delayed {
+		hidden = append(hidden, newMessageRecord(q.Name, message, messageDelayed))
+	}
+	sort.Slice(hidden, func(i, j int) bool {
+		return hidden[i].SentTime.Before(hidden[j].SentTime)
+	})
+	return append(records, hidden...)
+}
+
+// saveMessages writes every message of the queue to the store
+func (q *Queue) saveMessages() {
+	store := q.loadStore()
+	if store == nil {
+		return
+	}
+	for _, record := range q.messageRecords() {
+		put(store, messagesBucket, messageKey(q.Name, record.MessageId), record)
+	}
+}
+
+// newQueueFromSnapshot rebuilds a queue. In-flight and delayed messages get the rest of their timeout,
+// or become visible if it has passed.
+func newQueueFromSnapshot(snapshot QueueSnapshot, now time.Time) *Queue {
+	q := NewQueue(snapshot.Name, "")
+	q.URL = snapshot.URL
+	for name, value := range snapshot.Attributes {
+		q.setAttribute(name, value)
+	}
+	q.CreatedTimestamp = snapshot.CreatedTimestamp
+	q.LastModifiedTimestamp = snapshot.LastModifiedTimestamp
+	q.ExpiredMessages = snapshot.ExpiredMessages
+	q.sequenceNumber = snapshot.SequenceNumber
+
+	var visible []*Message
+	for _, record := range snapshot.Messages {
+		message := record.message()
+		if q.FifoQueue && message.MessageDeduplicationId != "" && now.Sub(message.SentTime) <= DeduplicationInterval {
+			deduplicationKey := message.MessageDeduplicationId
+			if q.DeduplicationScope == "messageGroup" {
+				deduplicationKey = message.MessageGroupId + ":" + deduplicationKey
+			}
+			q.addDeduplication(deduplicationKey, message)
+		}
+		switch {
+		case record.State == messageInFlight && message.VisibilityDeadline.After(now):
+			receiptHandle := message.ReceiptHandle
+			message.visibilityTimer = time.AfterFunc(message.VisibilityDeadline.Sub(now), func() {
+				q.ExpireVisibilityTimeout(receiptHandle)
+			})
+			q.InFlight[receiptHandle] = message
+		case record.State == messageDelayed && message.VisibleTime.After(now):
+			messageId := message.MessageId
+			message.delayTimer = time.AfterFunc(message.VisibleTime.Sub(now), func() {
+				q.ExpireDelay(messageId)
+			})
+			q.Delayed[messageId] = message
+		default:
+			message.VisibilityDeadline = time.Time{}
+			visible = append(visible, message)
+		}
+	}
+	sort.SliceStable(visible, func(i, j int) bool {
+		if q.FifoQueue {
+			return visible[i].SequenceNumber < visible[j].SequenceNumber
+		}
+		return visible[i].SentTime.Before(visible[j].SentTime)
+	})
+	for _, message := range visible {
+		q.Messages.Put(message)
+	}
+	return q
+}
+
+// AddQueue registers a queue and persists it
+func (c *SQS) AddQueue(q *Queue) {
+	c.lock.Lock()
+	q.setStore(c.store)
+	c.lock.Unlock()
+	q.save()
+	c.Queues.Put(q)
+}
+
+// RemoveQueue unregisters a queue and discards its messages, returns false if there is no such queue
+func (c *SQS) RemoveQueue(name string) bool {
+	removed := c.Queues.RemoveKey("name:" + name)
+	if removed == nil {
+		return false
+	}
+	q := removed.(*Queue)
+	q.Purge()
+	if store := q.loadStore(); store != nil {
+		if err := store.Delete(queuesBucket, q.Name); err != nil {
+			log.Errorf("Failed to delete queue %s from storage: %v", q.Name, err)
+		}
+	}
+	return true
+}
+
+// replaceQueue registers a rebuilt queue in place of any queue of the same name
+func (c *SQS) replaceQueue(q *Queue) {
+	c.Queues.RemoveKey("name:" + q.Name)
+	c.Queues.Put(q)
+}
+
+// SetStore selects the store queues and messages are persisted in and restores what it holds, a nil store persists nothing
+func (c *SQS) SetStore(store storage.Store) error {
+	c.lock.Lock()
+	c.store = store
+	c.lock.Unlock()
+	if store == nil {
+		for item := range c.Queues.Iterator() {
+			item.(*Queue).setStore(nil)
+		}
+		return nil
+	}
+
+	snapshots := make(map[string]*QueueSnapshot)
+	var names []string
+	err := store.ForEach(queuesBucket, func(key string, value []byte) error {
+		snapshot := &QueueSnapshot{}
+		if err := json.Unmarshal(value, &snapshot.QueueRecord); err != nil {
+			return err
+		}
+		snapshots[snapshot.Name] = snapshot
+		names = append(names, snapshot.Name)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = store.ForEach(messagesBucket, func(key string, value []byte) error {
+		var record MessageRecord
+		if err := json.Unmarshal(value, &record); err != nil {
+			return err
+		}
+		if snapshot, ok := snapshots[record.QueueName]; ok {
+			snapshot.Messages = append(snapshot.Messages, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, name := range names {
+		q := newQueueFromSnapshot(*snapshots[name], now)
+		q.setStore(store)
+		// Messages whose timeout passed while stopped are visible now
+		q.saveMessages()
+		c.replaceQueue(q)
+		log.Debugf("Restored queue %s with %d messages", name, len(snapshots[name].Messages))
+	}
+
+	// Queues created before the store was selected are persisted too
+	for item := range c.Queues.Iterator() {
+		if q := item.(*Queue); snapshots[q.Name] == nil {
+			q.setStore(store)
+			q.save()
+			q.saveMessages()
+		}
+	}
+	return nil
+}
+
+// Snapshot captures every queue with its messages
+func (c *SQS) Snapshot() []QueueSnapshot {
+	snapshots := []QueueSnapshot{}
+	for item := range c.Queues.Iterator() {
+		q := item.(*Queue)
+		snapshots = append(snapshots, QueueSnapshot{QueueRecord: q.record(), Messages: q.messageRecords()})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Name < snapshots[j].Name
+	})
+	return snapshots
+}
+
+// Restore replaces every queue with the ones of the snapshot and persists them
+func (c *SQS) Restore(snapshots []QueueSnapshot) {
+	var names []string
+	for item := range c.Queues.Iterator() {
+		names = append(names, item.(*Queue).Name)
+	}
+	for _, name := range names {
+		c.RemoveQueue(name)
+	}
+	now := time.Now()
+	for _, snapshot := range snapshots {
+		q := newQueueFromSnapshot(snapshot, now)
+		c.AddQueue(q)
+		q.saveMessages()
+	}
+}
@@ -0,0 +1,188 @@
+package sqs
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Tweddle-SE-Team/goaws/services/storage"
+)
+
+func TestSetStore_RestoresQueuesAndMessages(t *testing.T) {
+	store := storage.NewMemoryStore()
+	service := NewSQS()
+	service.SetStore(store)
+	queue := NewQueue("persistent-queue", "localhost:4100")
+	service.AddQueue(queue)
+	if err := queue.SetAttributes(map[string]string{"VisibilityTimeout": "60"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{"first", "second", "third"} {
+		if _, err := queue.SendMessage(NewMessage([]byte(body), nil, "", "")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	delayed := NewMessage([]byte("delayed"), nil, "", "")
+	delayed.DelaySeconds = 300
+	queue.SendMessage(delayed)
+
+	form := url.Values{}
+	form.Set("QueueUrl", queue.URL)
+	received := receive(t, service, form)
+	if len(received) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(received))
+	}
+	if !queue.DeleteMessage(receive(t, service, form)[0].ReceiptHandle) {
+		t.Fatal("expected the second message to be deleted")
+	}
+
+	restored := NewSQS()
+	if err := restored.SetStore(store); err != nil {
+		t.Fatal(err)
+	}
+	restoredQueue := restored.GetQueue("persistent-queue")
+	if restoredQueue == nil {
+		t.Fatal("expected the queue to be restored")
+	}
+	if restoredQueue.TimeoutSecs != 60 || restoredQueue.URL != queue.URL {
+		t.Errorf("expected attributes to be restored, got VisibilityTimeout %d and URL %s", restoredQueue.TimeoutSecs, restoredQueue.URL)
+	}
+	if size := restoredQueue.Messages.Size(); size != 1 {
+		t.Errorf("expected 1 visible message, got %d", size)
+	}
+	if size := restoredQueue.InFlightSize(); size != 1 {
+		t.Errorf("expected 1 in-flight message, got %d", size)
+	}
+	if size := restoredQueue.DelayedSize(); size != 1 {
+		t.Errorf("expected 1 delayed message, got %d", size)
+	}
+	// The restored in-flight message can still be deleted with the receipt handle it was received with
+	if !restoredQueue.DeleteMessage(received[0].ReceiptHandle) {
+		t.Errorf("expected the in-flight message to be deleted after restoring")
+	}
+	restoredQueue.Purge()
+}
+
+func TestSetStore_ExpiredVisibilityTimeout(t *testing.T) {
+	store := storage.NewMemoryStore()
+	service := NewSQS()
+	service.SetStore(store)
+	queue := NewQueue("expired-queue", "localhost:4100")
+	service.AddQueue(queue)
+	// The server stopped while the message was in flight and its visibility timeout passed since
+	message := NewMessage([]byte("hello"), nil, "", "")
+	message.UpdateReceiptHandle()
+	message.VisibilityDeadline = time.Now().Add(-time.Second)
+	queue.saveMessage(message, messageInFlight)
+
+	restored := NewSQS()
+	if err := restored.SetStore(store); err != nil {
+		t.Fatal(err)
+	}
+	restoredQueue := restored.GetQueue("expired-queue")
+	if restoredQueue.Messages.Size() != 1 || restoredQueue.InFlightSize() != 0 {
+		t.Errorf("expected the message to be visible, got %d visible and %d in flight", restoredQueue.Messages.Size(), restoredQueue.InFlightSize())
+	}
+}
+
+func TestSetStore_FifoSequenceNumber(t *testing.T) {
+	store := storage.NewMemoryStore()
+	service := NewSQS()
+	service.SetStore(store)
+	queue := NewQueue("persistent.fifo", "localhost:4100")
+	service.AddQueue(queue)
+	queue.SetAttributes(map[string]string{"ContentBasedDeduplication": "true"})
+	for _, body := range []string{"a", "b"} {
+		message := NewMessage([]byte(body), nil, "", "")
+		message.MessageGroupId = "group"
+		queue.SendMessage(message)
+	}
+
+	restored := NewSQS()
+	restored.SetStore(store)
+	restoredQueue := restored.GetQueue("persistent.fifo")
+	messages := restoredQueue.visibleMessages()
+	if len(messages) != 2 || string(messages[0].MessageBody) != "a" || string(messages[1].MessageBody) != "b" {
+		t.Fatalf("expected messages a and b in order, got %v", messages)
+	}
+	duplicate := NewMessage([]byte("a"), nil, "", "")
+	duplicate.MessageGroupId = "group"
+	if original, _ := restoredQueue.SendMessage(duplicate); original.MessageId != messages[0].MessageId {
+		t.Errorf("expected the deduplication window to survive a restart")
+	}
+	next := NewMessage([]byte("c"), nil, "", "")
+	next.MessageGroupId = "group"
+	restoredQueue.SendMessage(next)
+	if next.SequenceNumber <= messages[1].SequenceNumber {
+		t.Errorf("expected sequence number %s to follow %s", next.SequenceNumber, messages[1].SequenceNumber)
+	}
+}
+
+func TestDeleteQueue_RemovesStoredMessages(t *testing.T) {
+	store := storage.NewMemoryStore()
+	service := NewSQS()
+	service.SetStore(store)
+	queue := NewQueue("deleted-queue", "localhost:4100")
+	service.AddQueue(queue)
+	queue.SendMessage(NewMessage([]byte("hello"), nil, "", ""))
+
+	if !service.RemoveQueue("deleted-queue") {
+		t.Fatal("expected the queue to be removed")
+	}
+	for _, bucket := range []string{queuesBucket, messagesBucket} {
+		store.ForEach(bucket, func(key string, value []byte) error {
+			t.Errorf("expected %s to be empty, found %s", bucket, key)
+			return nil
+		})
+	}
+}
+
+func TestSetStore_Nil(t *testing.T) {
+	store := storage.NewMemoryStore()
+	service := NewSQS()
+	service.SetStore(store)
+	queue := NewQueue("detached-queue", "localhost:4100")
+	service.AddQueue(queue)
+	if err := service.SetStore(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := queue.SendMessage(NewMessage([]byte("unsaved"), nil, "", "")); err != nil {
+		t.Fatal(err)
+	}
+	service.AddQueue(NewQueue("memory-queue", "localhost:4100"))
+
+	restored := NewSQS()
+	if err := restored.SetStore(store); err != nil {
+		t.Fatal(err)
+	}
+	if restored.GetQueue("memory-queue") != nil {
+		t.Errorf("expected a queue added without a store not to be saved")
+	}
+	if restoredQueue := restored.GetQueue("detached-queue"); restoredQueue == nil || restoredQueue.Messages.Size() != 0 {
+		t.Errorf("expected the message sent without a store not to be saved")
+	}
+	queue.Purge()
+}
+
+func TestSetStore_ConcurrentSends(t *testing.T) {
+	service := NewSQS()
+	queue := NewQueue("switched-queue", "localhost:4100")
+	service.AddQueue(queue)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			if _, err := queue.SendMessage(NewMessage([]byte("switched"), nil, "", "")); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if err := service.SetStore(storage.NewMemoryStore()); err != nil {
+			t.Fatal(err)
+		}
+		service.SetStore(nil)
+	}
+	<-done
+	queue.Purge()
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// FileStore is an append-only log of record changes. Opening it replays the log and rewrites it
+// with only the current records, so the file does not grow across restarts.
+type FileStore struct {
+	*MemoryStore
+	path string
+	file *os.File
+}
+
+type logEntry struct {
+	Delete bool            `json:"delete,omitempty"`
+	Bucket string          `json:"bucket"`
+	Key    string          `json:"key"`
+	Value  json.RawMessage `json:"value,omitempty"`
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	store := &FileStore{MemoryStore: NewMemoryStore(), path: path}
+	if err := store.replay(); err != nil {
+		return nil, err
+	}
+	if err := store.compact(); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	store.file = file
+	return store, nil
+}
+
+func (s *FileStore) replay() error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var entry logEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A crash while appending leaves a partial last line
+			log.Warnf("Skipping unreadable entry in %s: %v", s.path, err)
+			continue
+		}
+		if entry.Delete {
+			delete(s.buckets[entry.Bucket], entry.Key)
+		} else {
+			s.put(entry.Bucket, entry.Key, entry.Value)
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *FileStore) compact() error {
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	buckets := make([]string, 0, len(s.buckets))
+	for bucket := range s.buckets {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+	for _, bucket := range buckets {
+		err = s.MemoryStore.ForEach(bucket, func(key string, value []byte) error {
+			return writeEntry(writer, logEntry{Bucket: bucket, Key: key, Value: value})
+		})
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+func writeEntry(writer interface{ Write([]byte) (int, error) }, entry logEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(append(line, '\n'))
+	return err
+}
+
+func (s *FileStore) Put(bucket string, key string, value []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := writeEntry(s.file, logEntry{Bucket: bucket, Key: key, Value: value}); err != nil {
+		return err
+	}
+	s.put(bucket, key, value)
+	return nil
+}
+
+func (s *FileStore) Delete(bucket string, key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.buckets[bucket][key]; !ok {
+		return nil
+	}
+	if err := writeEntry(s.file, logEntry{Delete: true, Bucket: bucket, Key: key}); err != nil {
+		return err
+	}
+	delete(s.buckets[bucket], key)
+	return nil
+}
+
+func (s *FileStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.file.Close()
+}
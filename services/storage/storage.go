@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Store keeps the state of the emulator as records grouped in buckets, SQS and SNS write every change through it
+type Store interface {
+	Put(bucket string, key string, value []byte) error
+	Delete(bucket string, key string) error
+	// ForEach calls fn for every record of the bucket in key order
+	ForEach(bucket string, fn func(key string, value []byte) error) error
+	Close() error
+}
+
+// Open returns the store selected in the configuration: "memory" (the default) or "file".
+// The memory state of SQS and SNS needs no store, so memory returns a nil Store
+func Open(kind string, path string) (Store, error) {
+	switch kind {
+	case "", "memory":
+		return nil, nil
+	case "file":
+		return NewFileStore(path)
+	}
+	return nil, fmt.Errorf("unknown storage %q, expected memory or file", kind)
+}
+
+// MemoryStore keeps records for as long as the process runs
+type MemoryStore struct {
+	buckets map[string]map[string][]byte
+	lock    sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]map[string][]byte)}
+}
+
+func (s *MemoryStore) Put(bucket string, key string, value []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.put(bucket, key, value)
+	return nil
+}
+
+func (s *MemoryStore) put(bucket string, key string, value []byte) {
+	records, ok := s.buckets[bucket]
+	if !ok {
+		records = make(map[string][]byte)
+		s.buckets[bucket] = records
+	}
+	records[key] = append([]byte(nil), value...)
+}
+
+func (s *MemoryStore) Delete(bucket string, key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.buckets[bucket], key)
+	return nil
+}
+
+func (s *MemoryStore) ForEach(bucket string, fn func(key string, value []byte) error) error {
+	s.lock.RLock()
+	records := s.buckets[bucket]
+	keys := make([]string, 0, len(records))
+	for key := range records {
+		keys = append(keys, key)
+	}
+	values := make(map[string][]byte, len(records))
+	for _, key := range keys {
+		values[key] = records[key]
+	}
+	s.lock.RUnlock()
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := fn(key, values[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
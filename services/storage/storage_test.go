@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func records(t *testing.T, store Store, bucket string) map[string]string {
+	values := make(map[string]string)
+	err := store.ForEach(bucket, func(key string, value []byte) error {
+		values[key] = string(value)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	store.Put("queues", "b", []byte(`2`))
+	store.Put("queues", "a", []byte(`1`))
+	store.Put("topics", "a", []byte(`3`))
+	store.Delete("queues", "b")
+
+	var keys []string
+	store.ForEach("queues", func(key string, value []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if len(keys) != 1 || keys[0] != "a" {
+		t.Errorf("expected only key a in queues, got %v", keys)
+	}
+	if values := records(t, store, "topics"); values["a"] != "3" {
+		t.Errorf("expected topics to be untouched, got %v", values)
+	}
+}
+
+func TestFileStore_Reopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goaws-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.log")
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Put("queues", "a", []byte(`{"Name":"a"}`))
+	store.Put("queues", "b", []byte(`{"Name":"b"}`))
+	store.Put("queues", "a", []byte(`{"Name":"a","Updated":true}`))
+	store.Delete("queues", "b")
+	store.Close()
+
+	store, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	values := records(t, store, "queues")
+	if len(values) != 1 || values["a"] != `{"Name":"a","Updated":true}` {
+		t.Errorf("unexpected records after reopening: %v", values)
+	}
+
+	// Reopening compacts the log to the current records
+	content, _ := ioutil.ReadFile(path)
+	if lines := strings.Count(string(content), "\n"); lines != 1 {
+		t.Errorf("expected 1 line after compaction, got %d", lines)
+	}
+}
+
+func TestFileStore_PartialEntry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goaws-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.log")
+	content := `{"bucket":"queues","key":"a","value":{"Name":"a"}}` + "\n" + `{"bucket":"queues","key":"b","val`
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if values := records(t, store, "queues"); len(values) != 1 || values["a"] != `{"Name":"a"}` {
+		t.Errorf("expected the complete entry to be restored, got %v", values)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if store, err := Open("", ""); err != nil || store != nil {
+		t.Errorf("expected no store by default, got %v %v", store, err)
+	}
+	if _, err := Open("redis", ""); err == nil {
+		t.Errorf("expected an error for an unknown storage")
+	}
+}
@@ -28,7 +28,7 @@ func TestNewIntegration(t *testing.T) {
 	testTable := []struct {
 		Name      string
 		Expected  []string
-		QueueFunc func(sqsiface.SQSAPI, *string) error
+		QueueFunc func(*testing.T, sqsiface.SQSAPI, *string) error
 	}{
 		{
 			Name:      "Empty queue OK",
@@ -38,17 +38,17 @@ func TestNewIntegration(t *testing.T) {
 		{
 			Name:     "Some messages OK",
 			Expected: []string{"hello world"},
-			QueueFunc: func(svc sqsiface.SQSAPI, queueURL *string) error {
+			QueueFunc: func(t *testing.T, svc sqsiface.SQSAPI, queueURL *string) error {
 				attributes := make(map[string]*sqs.MessageAttributeValue)
-				attributes["some string"] = &sqs.MessageAttributeValue{
+				attributes["some_string"] = &sqs.MessageAttributeValue{
 					StringValue: aws.String("string value with a special character \u2318"),
 					DataType:    aws.String("String"),
 				}
-				attributes["some number"] = &sqs.MessageAttributeValue{
+				attributes["some_number"] = &sqs.MessageAttributeValue{
 					StringValue: aws.String("123"),
 					DataType:    aws.String("Number"),
 				}
-				attributes["some binary"] = &sqs.MessageAttributeValue{
+				attributes["some_binary"] = &sqs.MessageAttributeValue{
 					BinaryValue: []byte{1, 2, 3},
 					DataType:    aws.String("Binary"),
 				}
@@ -60,13 +60,17 @@ func TestNewIntegration(t *testing.T) {
 				})
 
 				assert.Equal(t, "5eb63bbbe01eeed093cb22bb8f5acdc3", *response.MD5OfMessageBody)
-				assert.Equal(t, "7820c7a3712c7c359cf80485f67aa34d", *response.MD5OfMessageAttributes)
+				assert.Equal(t, "5e7cf12121831a527e7e6b04c562fbac", *response.MD5OfMessageAttributes)
 				return err
 			},
 		},
 	}
 	for _, tr := range testTable {
+		tr := tr
 		t.Run(tr.Name, func(t *testing.T) {
+			// Every server has its own emulator, so subtests do not share queues
+			t.Parallel()
+
 			// Start local SQS
 			srv, err := New("")
 			noSetupError(t, err)
@@ -84,7 +88,7 @@ func TestNewIntegration(t *testing.T) {
 			queueURL := getQueueUrlOutput.QueueUrl
 
 			// Setup Queue Sate
-			err = tr.QueueFunc(svc, queueURL)
+			err = tr.QueueFunc(t, svc, queueURL)
 			noSetupError(t, err)
 
 			// Test
@@ -116,7 +120,7 @@ func newSQS(t *testing.T, region string, endpoint string) *sqs.SQS {
 	return svc
 }
 
-func noOp(sqsiface.SQSAPI, *string) error {
+func noOp(*testing.T, sqsiface.SQSAPI, *string) error {
 	return nil
 }
 